@@ -0,0 +1,91 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"visitor/internal/geoip"
+	"visitor/internal/hash"
+	"visitor/internal/importer"
+	"visitor/internal/storage"
+)
+
+// runImport implements "visitor import", which loads historical data into a
+// site:
+//
+//	visitor import -domain example.com -format log access.log access.log.1.gz
+//	visitor import -domain example.com -format ga pages.csv
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	databaseURL := fs.String("database-url", envOrDefault("DATABASE_URL", defaultDatabaseURL), "PostgreSQL connection string")
+	geoDB := fs.String("geoip-db", envOrDefault("GEOIP_DB", "GeoLite2-Country.mmdb"), "GeoLite2-Country database path (empty = disable country detection)")
+	asnDB := fs.String("geoip-asn-db", envOrDefault("GEOIP_ASN_DB", "GeoLite2-ASN.mmdb"), "GeoLite2-ASN database path (empty = disable datacenter detection)")
+	domain := fs.String("domain", "", "Site to import into")
+	format := fs.String("format", "", "Input format: ga, plausible (CSV exports) or log (Combined Log Format)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: visitor import -domain example.com -format ga|plausible|log file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *domain == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	switch *format {
+	case importer.FormatGA, importer.FormatPlausible, importer.FormatLog:
+	default:
+		fatal("Unknown format", "format", *format)
+	}
+
+	ctx := context.Background()
+
+	db, err := storage.New(ctx, *databaseURL)
+	if err != nil {
+		fatal("Failed to connect to database", "err", err)
+	}
+	defer db.Close()
+
+	geo := geoip.New(*geoDB, *asnDB)
+	defer geo.Close()
+
+	im := importer.New(db, hash.NewManager(db.Pool()), geo)
+
+	for _, name := range fs.Args() {
+		res, err := importFile(ctx, im, name, *domain, *format)
+		if err != nil {
+			fatal("Failed to import", "file", name, "err", err)
+		}
+		slog.Info("Imported", "file", name, "domain", res.Domain, "rows", res.Imported, "skipped", res.Skipped)
+	}
+}
+
+func importFile(ctx context.Context, im *importer.Importer, name, domain, format string) (importer.Result, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return importer.Result{}, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	// Rotated logs are usually compressed.
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return importer.Result{}, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if format == importer.FormatLog {
+		return im.AccessLog(ctx, r, domain)
+	}
+	return im.CSV(ctx, r, domain, format)
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	_ "embed"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// Reasons a request is classified as automated.
+const (
+	ReasonParser           = "parser"
+	ReasonPattern          = "pattern"
+	ReasonHeadless         = "headless"
+	ReasonEmptyUserAgent   = "empty_user_agent"
+	ReasonNoAcceptLanguage = "no_accept_language"
+)
+
+//go:embed patterns.txt
+var patternsFile string
+
+var patterns = parsePatterns(patternsFile)
+
+// headlessMarkers identify automated browsers that otherwise send a regular
+// desktop User-Agent.
+var headlessMarkers = []string{
+	"headless",
+	"phantomjs",
+	"puppeteer",
+	"playwright",
+	"selenium",
+	"webdriver",
+}
+
+// parsePatterns compiles the patterns of file into one case-insensitive
+// regexp.
+func parsePatterns(file string) *regexp.Regexp {
+	var out []string
+	for line := range strings.Lines(file) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, "(?:"+line+")")
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(out, "|"))
+}
+
+// Detect reports why a request looks automated, or "" when it looks like a
+// real browser. ua must be the parsed User-Agent of the same request.
+func Detect(ua *useragent.UserAgent, header http.Header) string {
+	if reason := DetectUserAgent(ua); reason != "" {
+		return reason
+	}
+
+	brands := strings.ToLower(header.Get("Sec-CH-UA"))
+	for _, m := range headlessMarkers {
+		if strings.Contains(brands, m) {
+			return ReasonHeadless
+		}
+	}
+
+	// Every mainstream browser sends Accept-Language, most scripts don't.
+	if header.Get("Accept-Language") == "" {
+		return ReasonNoAcceptLanguage
+	}
+
+	return ""
+}
+
+// DetectUserAgent is Detect without the heuristics that rely on browser
+// request headers, for events reported by servers on a client's behalf.
+func DetectUserAgent(ua *useragent.UserAgent) string {
+	raw := ua.UA()
+	if strings.TrimSpace(raw) == "" {
+		return ReasonEmptyUserAgent
+	}
+
+	if ua.Bot() {
+		return ReasonParser
+	}
+
+	lower := strings.ToLower(raw)
+	for _, m := range headlessMarkers {
+		if strings.Contains(lower, m) {
+			return ReasonHeadless
+		}
+	}
+
+	if patterns.MatchString(raw) {
+		return ReasonPattern
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mssola/useragent"
+)
+
+const (
+	uaChrome   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	uaHeadless = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/124.0.0.0 Safari/537.36"
+)
+
+func TestDetectUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		bot  bool
+	}{
+		{"googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"bingbot", "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", true},
+		{"ahrefs", "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", true},
+		{"adsbot", "AdsBot-Google (+http://www.google.com/adsbot.html)", true},
+		{"petalbot", "Mozilla/5.0 (Linux; Android 7.0;) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; PetalBot;+https://webmaster.petalsearch.com/site/petalbot)", true},
+		{"bytespider", "Mozilla/5.0 (Linux; Android 5.0) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; Bytespider; spider-feedback@bytedance.com)", true},
+		{"feed fetcher", "FeedFetcher-Google; (+http://www.google.com/feedfetcher.html)", true},
+		{"link preview", "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5", true},
+		{"facebook unfurler", "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"slackbot", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"uptime monitor", "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", true},
+		{"curl", "curl/8.5.0", true},
+		{"python", "python-requests/2.31.0", true},
+		{"go", "Go-http-client/2.0", true},
+		{"ruby", "Ruby", true},
+		{"lighthouse", "Mozilla/5.0 (Linux; Android 11; moto g power (2022)) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Mobile Safari/537.36 Chrome-Lighthouse", true},
+		{"headless chrome", uaHeadless, true},
+		{"empty", "", true},
+
+		{"chrome", uaChrome, false},
+		{"firefox", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", false},
+		{"safari", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15", false},
+		{"cubot phone", "Mozilla/5.0 (Linux; Android 10; Cubot X30 Build/QP1A.190711.020) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", false},
+		{"cubot underscore model", "Mozilla/5.0 (Linux; Android 9; CUBOT_X19 Build/PPR1.180610.011) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", false},
+		{"ruby device codename", "Mozilla/5.0 (Linux; Android 13; 22101316G Build/TP1A.220624.014; ruby) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", false},
+		{"monitor in a device name", "Mozilla/5.0 (Linux; Android 12; BabyMonitor Pro) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", false},
+		{"fetch in an app name", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 FetchRewards", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := DetectUserAgent(useragent.New(tt.ua))
+			if (reason != "") != tt.bot {
+				t.Errorf("DetectUserAgent(%q) = %q, want bot %v", tt.ua, reason, tt.bot)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	browserHeader := http.Header{
+		"Accept-Language": {"en-US,en;q=0.9"},
+		"Sec-Ch-Ua":       {`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+	}
+
+	tests := []struct {
+		name   string
+		ua     string
+		header http.Header
+		want   string
+	}{
+		{"browser", uaChrome, browserHeader, ""},
+		{"empty user agent", "", browserHeader, ReasonEmptyUserAgent},
+		{"headless user agent", uaHeadless, browserHeader, ReasonHeadless},
+		{"headless brand", uaChrome, http.Header{
+			"Accept-Language": {"en"},
+			"Sec-Ch-Ua":       {`"HeadlessChrome";v="124"`},
+		}, ReasonHeadless},
+		{"no accept language", uaChrome, http.Header{}, ReasonNoAcceptLanguage},
+		{"pattern", "uptime-kuma/1.23.0", browserHeader, ReasonPattern},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(useragent.New(tt.ua), tt.header); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// Device types stored in page_views.device_type.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Info is what we store about the software a visitor uses.
+type Info struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	DeviceType     string
+}
+
+// Parse extracts browser, OS and device information from a User-Agent,
+// preferring User-Agent Client Hints from header when the browser sent them.
+// Versions are trimmed so the breakdowns stay readable: browsers to their
+// major version, operating systems to major.minor.
+func Parse(ua *useragent.UserAgent, header http.Header) Info {
+	browser, browserVersion := ua.Browser()
+	osInfo := ua.OSInfo()
+
+	info := Info{
+		Browser:        browser,
+		BrowserVersion: trimVersion(browserVersion, 1),
+		OS:             osName(osInfo.Name),
+		OSVersion:      trimVersion(osInfo.Version, 2),
+		DeviceType:     deviceType(ua),
+	}
+	if info.DeviceType != DeviceBot {
+		applyHints(&info, header)
+	}
+
+	return info
+}
+
+// osName names operating systems like Client Hints do where the User-Agent
+// parser differs, e.g. "CrOS x86_64" is "ChromeOS".
+func osName(name string) string {
+	if strings.HasPrefix(name, "CrOS") {
+		return "ChromeOS"
+	}
+	return name
+}
+
+func deviceType(ua *useragent.UserAgent) string {
+	if ua.Bot() {
+		return DeviceBot
+	}
+
+	raw := ua.UA()
+	if strings.Contains(raw, "iPad") || strings.Contains(raw, "Tablet") ||
+		(strings.Contains(raw, "Android") && !strings.Contains(raw, "Mobile")) {
+		return DeviceTablet
+	}
+
+	if ua.Mobile() {
+		return DeviceMobile
+	}
+
+	return DeviceDesktop
+}
+
+// trimVersion keeps the first parts components of a dotted version.
+func trimVersion(version string, parts int) string {
+	fields := strings.SplitN(version, ".", parts+1)
+	if len(fields) > parts {
+		fields = fields[:parts]
+	}
+	return strings.Join(fields, ".")
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptCH lists the User-Agent Client Hints the tracker asks browsers for.
+// Browsers ignore it on the tracker's own response, the embedding page has to
+// send it and delegate the hints to the tracker's origin, see the README.
+const AcceptCH = "Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version, Sec-CH-UA-Full-Version-List"
+
+// brandNames maps Client Hints brands to the names the User-Agent parser
+// reports, so both sources land in the same browser row.
+var brandNames = map[string]string{
+	"Google Chrome":  "Chrome",
+	"Microsoft Edge": "Edge",
+	"Opera GX":       "Opera",
+}
+
+var platformNames = map[string]string{
+	"macOS":     "Mac OS X",
+	"Chrome OS": "ChromeOS",
+}
+
+type brand struct {
+	name    string
+	version string
+}
+
+// applyHints overrides info with whatever Client Hints the request carries.
+// Sec-CH-UA-Platform is sent by default, the platform version only when the
+// site delegates it, so the User-Agent's OS version stays unless the hint
+// replaces it or names another OS.
+func applyHints(info *Info, header http.Header) {
+	brands := parseBrands(header.Get("Sec-CH-UA-Full-Version-List"))
+	if len(brands) == 0 {
+		brands = parseBrands(header.Get("Sec-CH-UA"))
+	}
+	if b, ok := pickBrand(brands); ok {
+		info.Browser = b.name
+		info.BrowserVersion = trimVersion(b.version, 1)
+	}
+
+	if platform := unquote(header.Get("Sec-CH-UA-Platform")); platform != "" {
+		if name, ok := platformNames[platform]; ok {
+			platform = name
+		}
+		if platform != info.OS {
+			info.OS = platform
+			info.OSVersion = ""
+		}
+
+		if version := unquote(header.Get("Sec-CH-UA-Platform-Version")); version != "" {
+			info.OSVersion = platformVersion(platform, version)
+		}
+	}
+
+	if header.Get("Sec-CH-UA-Mobile") == "?1" {
+		info.DeviceType = DeviceMobile
+	}
+}
+
+// pickBrand prefers a vendor brand such as "Google Chrome" over the generic
+// "Chromium" entry, and ignores GREASE brands like "Not_A Brand".
+func pickBrand(brands []brand) (brand, bool) {
+	var chromium *brand
+	for i, b := range brands {
+		if isGrease(b.name) {
+			continue
+		}
+		if b.name == "Chromium" {
+			chromium = &brands[i]
+			continue
+		}
+		if name, ok := brandNames[b.name]; ok {
+			b.name = name
+		}
+		return b, true
+	}
+
+	if chromium != nil {
+		return *chromium, true
+	}
+	return brand{}, false
+}
+
+func isGrease(name string) bool {
+	return strings.Contains(name, "Brand") && strings.Contains(name, "Not")
+}
+
+// platformVersion maps Windows platform versions to marketing names, see
+// https://learn.microsoft.com/en-us/microsoft-edge/web-platform/how-to-detect-win11
+func platformVersion(platform, version string) string {
+	if platform != "Windows" {
+		return trimVersion(version, 2)
+	}
+
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	switch {
+	case err != nil:
+		return ""
+	case major >= 13:
+		return "11"
+	case major > 0:
+		return "10"
+	default:
+		return ""
+	}
+}
+
+// parseBrands parses a structured header brand list such as
+// `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`.
+func parseBrands(value string) []brand {
+	var out []brand
+	for _, item := range splitQuoted(value, ',') {
+		params := splitQuoted(item, ';')
+		if len(params) == 0 {
+			continue
+		}
+
+		b := brand{name: unquote(params[0])}
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "v="); ok {
+				b.version = unquote(v)
+			}
+		}
+		if b.name != "" {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// splitQuoted splits s on sep, ignoring separators inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var out []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				out = append(out, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	return strings.ReplaceAll(s, `\"`, `"`)
+}
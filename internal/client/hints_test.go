@@ -0,0 +1,114 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mssola/useragent"
+)
+
+const (
+	uaWindowsChrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	uaMacChrome     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	uaChromeOS      = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	uaAndroid       = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	uaFirefox       = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		ua     string
+		header map[string]string
+		want   Info
+	}{
+		{
+			name: "user agent only",
+			ua:   uaFirefox,
+			want: Info{Browser: "Firefox", BrowserVersion: "125", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "default hints keep the user agent os version",
+			ua:   uaWindowsChrome,
+			header: map[string]string{
+				"Sec-CH-UA":          `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`,
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"Windows"`,
+			},
+			want: Info{Browser: "Chrome", BrowserVersion: "124", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "platform version tells windows 11 apart",
+			ua:   uaWindowsChrome,
+			header: map[string]string{
+				"Sec-CH-UA-Platform":         `"Windows"`,
+				"Sec-CH-UA-Platform-Version": `"15.0.0"`,
+			},
+			want: Info{Browser: "Chrome", BrowserVersion: "124", OS: "Windows", OSVersion: "11", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "macos platform maps to the user agent name",
+			ua:   uaMacChrome,
+			header: map[string]string{
+				"Sec-CH-UA-Platform":         `"macOS"`,
+				"Sec-CH-UA-Platform-Version": `"14.4.1"`,
+			},
+			want: Info{Browser: "Chrome", BrowserVersion: "124", OS: "Mac OS X", OSVersion: "14.4", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "chromeos from the user agent",
+			ua:   uaChromeOS,
+			want: Info{Browser: "Chrome", BrowserVersion: "124", OS: "ChromeOS", OSVersion: "14541.0", DeviceType: DeviceDesktop},
+		},
+		{
+			name:   "chromeos hint matches the user agent name",
+			ua:     uaChromeOS,
+			header: map[string]string{"Sec-CH-UA-Platform": `"Chrome OS"`},
+			want:   Info{Browser: "Chrome", BrowserVersion: "124", OS: "ChromeOS", OSVersion: "14541.0", DeviceType: DeviceDesktop},
+		},
+		{
+			name:   "another platform drops the user agent version",
+			ua:     uaWindowsChrome,
+			header: map[string]string{"Sec-CH-UA-Platform": `"Linux"`},
+			want:   Info{Browser: "Chrome", BrowserVersion: "124", OS: "Linux", OSVersion: "", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "full version list wins over the brand list",
+			ua:   uaWindowsChrome,
+			header: map[string]string{
+				"Sec-CH-UA":                   `"Chromium";v="124", "Microsoft Edge";v="124"`,
+				"Sec-CH-UA-Full-Version-List": `"Not_A Brand";v="8.0.0.0", "Chromium";v="125.0.6422.60", "Microsoft Edge";v="125.0.2535.51"`,
+			},
+			want: Info{Browser: "Edge", BrowserVersion: "125", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name:   "chromium brand alone",
+			ua:     uaWindowsChrome,
+			header: map[string]string{"Sec-CH-UA": `"Not;A=Brand";v="24", "Chromium";v="128"`},
+			want:   Info{Browser: "Chromium", BrowserVersion: "128", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "mobile hint",
+			ua:   uaAndroid,
+			header: map[string]string{
+				"Sec-CH-UA-Mobile":   "?1",
+				"Sec-CH-UA-Platform": `"Android"`,
+			},
+			want: Info{Browser: "Chrome", BrowserVersion: "124", OS: "Android", OSVersion: "14", DeviceType: DeviceMobile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+
+			got := Parse(useragent.New(tt.ua), header)
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
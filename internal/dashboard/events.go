@@ -0,0 +1,275 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"visitor/internal/model"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	// eventPageSize is the number of rows fetched per keyset query.
+	eventPageSize = 1000
+	// defaultEventRange is the export range when "from" is not given.
+	defaultEventRange = 30 * 24 * time.Hour
+)
+
+// Raw event formats, next to formatCSV.
+const (
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+)
+
+// EventQuery selects raw page views for export.
+type EventQuery struct {
+	Domains []string
+	From    time.Time
+	To      time.Time
+	// After resumes an export after the row with this id.
+	After int64
+	// Limit caps the number of rows, 0 exports everything.
+	Limit int
+}
+
+// Events calls fn for each page view matching eq in id order. Rows are read
+// in pages of eventPageSize using keyset pagination, so memory use doesn't
+// grow with the export.
+func (q *Queries) Events(ctx context.Context, eq EventQuery, fn func(*model.RawEventWithHash) error) error {
+	after, sent := eq.After, 0
+	for {
+		pageSize := eventPageSize
+		if eq.Limit > 0 {
+			pageSize = min(pageSize, eq.Limit-sent)
+		}
+		if pageSize == 0 {
+			return nil
+		}
+
+		rows, err := q.pool.Query(ctx,
+			`SELECT id, domain, hostname, path, referrer, referrer_host, referrer_source, channel, country_code, screen_size,
+			   utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+			   browser, browser_version, os, os_version, device_type,
+			   asn, asn_org, is_datacenter, scroll_depth, engagement_ms, created_at, visitor_hash
+			 FROM page_views
+			 WHERE domain = ANY($1) AND created_at >= $2 AND created_at < $3 AND id > $4
+			 ORDER BY id
+			 LIMIT $5`,
+			eq.Domains, eq.From, eq.To, after, pageSize)
+		if err != nil {
+			return fmt.Errorf("events: %w", err)
+		}
+
+		n := 0
+		for rows.Next() {
+			var e model.RawEventWithHash
+			err := rows.Scan(&e.ID, &e.Domain, &e.Hostname, &e.Path, &e.Referrer, &e.ReferrerHost, &e.ReferrerSource, &e.Channel, &e.CountryCode, &e.ScreenSize,
+				&e.UTMSource, &e.UTMMedium, &e.UTMCampaign, &e.UTMTerm, &e.UTMContent,
+				&e.Browser, &e.BrowserVersion, &e.OS, &e.OSVersion, &e.DeviceType,
+				&e.ASN, &e.ASNOrg, &e.IsDatacenter, &e.ScrollDepth, &e.EngagementMs, &e.CreatedAt, &e.VisitorHash)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("scan event: %w", err)
+			}
+			if err := fn(&e); err != nil {
+				rows.Close()
+				return err
+			}
+			after = e.ID
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("events: %w", err)
+		}
+
+		sent += n
+		if n < pageSize {
+			return nil
+		}
+	}
+}
+
+// eventEncoder writes raw events in one export format.
+type eventEncoder interface {
+	encode(e *model.RawEventWithHash) error
+	close() error
+}
+
+type ndjsonEncoder struct {
+	enc      *json.Encoder
+	withHash bool
+}
+
+func (e *ndjsonEncoder) encode(ev *model.RawEventWithHash) error {
+	if e.withHash {
+		return e.enc.Encode(ev)
+	}
+	return e.enc.Encode(&ev.RawEvent)
+}
+
+func (e *ndjsonEncoder) close() error { return nil }
+
+type csvEncoder struct {
+	w        *csv.Writer
+	withHash bool
+}
+
+func newCSVEncoder(w io.Writer, withHash bool) (*csvEncoder, error) {
+	e := &csvEncoder{w: csv.NewWriter(w), withHash: withHash}
+	t := reflect.TypeFor[model.RawEvent]()
+	if withHash {
+		t = reflect.TypeFor[model.RawEventWithHash]()
+	}
+	return e, e.w.Write(csvHeader(t))
+}
+
+func (e *csvEncoder) encode(ev *model.RawEventWithHash) error {
+	row := reflect.ValueOf(ev.RawEvent)
+	if e.withHash {
+		row = reflect.ValueOf(*ev)
+	}
+	return e.w.Write(csvRecord(row))
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// parquetEncoder writes one row group per eventPageSize rows, so only that
+// many rows are buffered before they reach the client.
+type parquetEncoder[T any] struct {
+	w   *parquet.GenericWriter[T]
+	row func(*model.RawEventWithHash) T
+	n   int
+}
+
+func newParquetEncoder[T any](w io.Writer, row func(*model.RawEventWithHash) T) *parquetEncoder[T] {
+	return &parquetEncoder[T]{w: parquet.NewGenericWriter[T](w), row: row}
+}
+
+func (e *parquetEncoder[T]) encode(ev *model.RawEventWithHash) error {
+	if _, err := e.w.Write([]T{e.row(ev)}); err != nil {
+		return err
+	}
+	if e.n++; e.n%eventPageSize == 0 {
+		return e.w.Flush()
+	}
+	return nil
+}
+
+func (e *parquetEncoder[T]) close() error { return e.w.Close() }
+
+func newEventEncoder(w io.Writer, format string, withHash bool) (eventEncoder, error) {
+	switch format {
+	case formatCSV:
+		return newCSVEncoder(w, withHash)
+	case formatParquet:
+		if withHash {
+			return newParquetEncoder(w, func(e *model.RawEventWithHash) model.RawEventWithHash { return *e }), nil
+		}
+		return newParquetEncoder(w, func(e *model.RawEventWithHash) model.RawEvent { return e.RawEvent }), nil
+	default:
+		return &ndjsonEncoder{enc: json.NewEncoder(w), withHash: withHash}, nil
+	}
+}
+
+var eventContentTypes = map[string]string{
+	formatNDJSON:  "application/x-ndjson",
+	formatCSV:     "text/csv; charset=utf-8",
+	formatParquet: "application/vnd.apache.parquet",
+}
+
+// HandleExportEvents streams raw page views of a domain as NDJSON, CSV or
+// Parquet. Rows come in id order; a cut-off export resumes with
+// ?after=<last id received>.
+func (h *Handler) HandleExportEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eq := EventQuery{Domains: h.canonicalDomains(r.Context(), parseDomains(query["domain"])), To: time.Now()}
+	if len(eq.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+	contentType, ok := eventContentTypes[format]
+	if !ok {
+		http.Error(w, "format must be ndjson, csv or parquet", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if v := query.Get("to"); v != "" {
+		if eq.To, err = parseTime(v); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	eq.From = eq.To.Add(-defaultEventRange)
+	if v := query.Get("from"); v != "" {
+		if eq.From, err = parseTime(v); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("after"); v != "" {
+		if eq.After, err = strconv.ParseInt(v, 10, 64); err != nil || eq.After < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if eq.Limit, err = strconv.Atoi(v); err != nil || eq.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	withHash := query.Get("visitor_hash") != "omit"
+
+	// Large exports outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.Join(eq.Domains, "+")+"-events."+format))
+
+	enc, err := newEventEncoder(w, format, withHash)
+	if err == nil {
+		n := 0
+		err = h.queries.Events(r.Context(), eq, func(e *model.RawEventWithHash) error {
+			if n++; n%eventPageSize == 0 {
+				rc.Flush()
+			}
+			return enc.encode(e)
+		})
+	}
+	if err == nil {
+		err = enc.close()
+	}
+	if err != nil {
+		// Headers are sent by now, the client sees a truncated body.
+		slog.ErrorContext(r.Context(), "export events error", "err", err)
+	}
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates, which mean
+// midnight UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,232 @@
+package dashboard
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"visitor/internal/model"
+)
+
+// Report formats selected with ?format=.
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+type report struct {
+	name string
+	run  func(context.Context, Params) (any, error)
+}
+
+func reportOf[T any](name string, run func(context.Context, Params) (T, error)) report {
+	return report{name: name, run: func(ctx context.Context, p Params) (any, error) {
+		return run(ctx, p)
+	}}
+}
+
+// reports lists everything GET /api/export bundles, in the dashboard's order.
+func (h *Handler) reports() []report {
+	q := h.queries
+	return []report{
+		reportOf("summary", q.Summary),
+		reportOf("pages", q.Pages),
+		reportOf("sources", q.Sources),
+		reportOf("referrers", q.Referrers),
+		reportOf("channels", q.Channels),
+		reportOf("locations", q.Locations),
+		reportOf("sizes", q.Sizes),
+		reportOf("browsers", q.Browsers),
+		reportOf("systems", q.Systems),
+		reportOf("devices", q.Devices),
+		reportOf("networks", q.Networks),
+		reportOf("hosts", q.Hosts),
+		reportOf("utm_sources", q.UTMSources),
+		reportOf("utm_mediums", q.UTMMediums),
+		reportOf("utm_campaigns", q.UTMCampaigns),
+		reportOf("outbound", q.Outbound),
+		reportOf("downloads", q.Downloads),
+		reportOf("filtered", q.Filtered),
+	}
+}
+
+func parseFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", formatJSON:
+		return formatJSON, true
+	case formatCSV:
+		return formatCSV, true
+	default:
+		return "", false
+	}
+}
+
+// writeReport writes a report as JSON, or as a CSV download with
+// ?format=csv.
+func writeReport(w http.ResponseWriter, r *http.Request, name string, v any) {
+	format, ok := parseFormat(r)
+	if !ok {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+	if format == formatJSON {
+		writeJSON(w, v)
+		return
+	}
+
+	p := parseParams(r)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportName(p, name)+".csv"))
+	if err := writeCSV(w, v); err != nil {
+		slog.ErrorContext(r.Context(), "write csv error", "report", name, "err", err)
+	}
+}
+
+// HandleExport streams a zip with every report for the domain and period,
+// as CSV files or JSON with ?format=json.
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	format := formatCSV
+	if r.URL.Query().Get("format") != "" {
+		var ok bool
+		if format, ok = parseFormat(r); !ok {
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportName(p, "reports")+".zip"))
+
+	zw := zip.NewWriter(w)
+	for _, rep := range h.reports() {
+		data, err := rep.run(r.Context(), p)
+		if err != nil {
+			// The status is already sent, an incomplete zip is all we can
+			// signal.
+			slog.ErrorContext(r.Context(), "export error", "report", rep.name, "err", err)
+			return
+		}
+
+		f, err := zw.Create(rep.name + "." + format)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "export error", "report", rep.name, "err", err)
+			return
+		}
+		if format == formatCSV {
+			err = writeCSV(f, data)
+		} else {
+			err = json.NewEncoder(f).Encode(data)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "export error", "report", rep.name, "err", err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "export error", "err", err)
+	}
+}
+
+func exportName(p Params, name string) string {
+	if len(p.Domains) == 0 {
+		return fmt.Sprintf("%s-%dd", name, p.Days)
+	}
+	return fmt.Sprintf("%s-%s-%dd", strings.Join(p.Domains, "+"), name, p.Days)
+}
+
+// writeCSV writes a slice of report rows with their JSON names as the
+// header. The summary is written as its time series, breakdowns as the rows
+// of their page.
+func writeCSV(w io.Writer, v any) error {
+	switch r := v.(type) {
+	case *model.SummaryStats:
+		v = r.Series
+	case interface{ Items() any }:
+		v = r.Items()
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot write %T as csv", v)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader(rv.Type().Elem())); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := cw.Write(csvRecord(rv.Index(i))); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvColumns returns the fields of a row struct, with embedded structs
+// flattened.
+func csvColumns(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.Anonymous {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func csvHeader(t reflect.Type) []string {
+	var header []string
+	for _, f := range csvColumns(t) {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		header = append(header, name)
+	}
+	return header
+}
+
+func csvRecord(row reflect.Value) []string {
+	var record []string
+	for _, f := range csvColumns(row.Type()) {
+		field := row.FieldByIndex(f.Index)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				record = append(record, "")
+				continue
+			}
+			field = field.Elem()
+		}
+
+		switch v := field.Interface().(type) {
+		case string:
+			record = append(record, csvSafe(v))
+		case time.Time:
+			record = append(record, v.UTC().Format(time.RFC3339))
+		default:
+			record = append(record, fmt.Sprint(v))
+		}
+	}
+	return record
+}
+
+// csvSafe keeps spreadsheets from evaluating visitor-controlled values such
+// as paths and referrers as formulas.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
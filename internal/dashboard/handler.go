@@ -1,134 +1,368 @@
 package dashboard
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"visitor/internal/logging"
+	"visitor/internal/model"
+)
+
+// Page sizes of breakdown reports.
+const (
+	defaultLimit = 20
+	maxLimit     = 1000
 )
 
 type Handler struct {
 	queries *Queries
+	// canonical returns the site a host is recorded under, resolving
+	// aliases and "www." like ingestion does.
+	canonical func(ctx context.Context, host string) string
+	// knownTimezone reports whether the database accepts a timezone.
+	knownTimezone func(ctx context.Context, name string) (bool, error)
 }
 
-func NewHandler(queries *Queries) *Handler {
-	return &Handler{queries: queries}
+func NewHandler(queries *Queries, canonical func(ctx context.Context, host string) string, knownTimezone func(ctx context.Context, name string) (bool, error)) *Handler {
+	return &Handler{queries: queries, canonical: canonical, knownTimezone: knownTimezone}
 }
 
 func (h *Handler) HandleSummary(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.queries.Summary(r.Context(), domain, days)
+	stats, err := h.queries.Summary(r.Context(), p)
 	if err != nil {
-		log.Printf("summary query error: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "summary query error", err)
 		return
 	}
 
-	writeJSON(w, stats)
+	writeReport(w, r, "summary", stats)
 }
 
 func (h *Handler) HandlePages(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	pages, err := h.queries.Pages(r.Context(), domain, days)
+	pages, err := h.queries.Pages(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "pages query error", err)
 		return
 	}
 
-	writeJSON(w, pages)
+	writeReport(w, r, "pages", pages)
 }
 
 func (h *Handler) HandleReferrers(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	refs, err := h.queries.Referrers(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "referrers query error", err)
+		return
+	}
+
+	writeReport(w, r, "referrers", refs)
+}
+
+func (h *Handler) HandleSources(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Sources(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "sources query error", err)
+		return
+	}
+
+	writeReport(w, r, "sources", data)
+}
+
+func (h *Handler) HandleChannels(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	refs, err := h.queries.Referrers(r.Context(), domain, days)
+	data, err := h.queries.Channels(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "channels query error", err)
 		return
 	}
 
-	writeJSON(w, refs)
+	writeReport(w, r, "channels", data)
 }
 
 func (h *Handler) HandleLocations(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	data, err := h.queries.Locations(r.Context(), domain, days)
+	data, err := h.queries.Locations(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "locations query error", err)
 		return
 	}
 
-	writeJSON(w, data)
+	writeReport(w, r, "locations", data)
 }
 
 func (h *Handler) HandleSizes(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	data, err := h.queries.Sizes(r.Context(), domain, days)
+	data, err := h.queries.Sizes(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "sizes query error", err)
 		return
 	}
 
-	writeJSON(w, data)
+	writeReport(w, r, "sizes", data)
 }
 
 func (h *Handler) HandleBrowsers(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	data, err := h.queries.Browsers(r.Context(), domain, days)
+	data, err := h.queries.Browsers(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "browsers query error", err)
 		return
 	}
 
-	writeJSON(w, data)
+	writeReport(w, r, "browsers", data)
 }
 
 func (h *Handler) HandleSystems(w http.ResponseWriter, r *http.Request) {
-	domain, days := parseParams(r)
-	if domain == "" {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Systems(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "systems query error", err)
+		return
+	}
+
+	writeReport(w, r, "systems", data)
+}
+
+func (h *Handler) HandleUTMSources(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.UTMSources(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "utm sources query error", err)
+		return
+	}
+
+	writeReport(w, r, "utm_sources", data)
+}
+
+func (h *Handler) HandleUTMMediums(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.UTMMediums(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "utm mediums query error", err)
+		return
+	}
+
+	writeReport(w, r, "utm_mediums", data)
+}
+
+func (h *Handler) HandleUTMCampaigns(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.UTMCampaigns(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "utm campaigns query error", err)
+		return
+	}
+
+	writeReport(w, r, "utm_campaigns", data)
+}
+
+func (h *Handler) HandleOutbound(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
 
-	data, err := h.queries.Systems(r.Context(), domain, days)
+	data, err := h.queries.Outbound(r.Context(), p)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logging.InternalError(w, r, "outbound query error", err)
 		return
 	}
 
-	writeJSON(w, data)
+	writeReport(w, r, "outbound", data)
 }
 
-func parseParams(r *http.Request) (string, int) {
-	domain := r.URL.Query().Get("domain")
+func (h *Handler) HandleDownloads(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Downloads(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "downloads query error", err)
+		return
+	}
+
+	writeReport(w, r, "downloads", data)
+}
+
+func (h *Handler) HandleDevices(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Devices(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "devices query error", err)
+		return
+	}
+
+	writeReport(w, r, "devices", data)
+}
+
+func (h *Handler) HandleNetworks(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Networks(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "networks query error", err)
+		return
+	}
+
+	writeReport(w, r, "networks", data)
+}
+
+func (h *Handler) HandleHosts(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Hosts(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "hosts query error", err)
+		return
+	}
+
+	writeReport(w, r, "hosts", data)
+}
+
+func (h *Handler) HandleFiltered(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.Filtered(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "filtered query error", err)
+		return
+	}
+
+	writeReport(w, r, "filtered", data)
+}
+
+// HandleOverview lists every tracked site with its views, visitors and
+// time series for the period.
+func (h *Handler) HandleOverview(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+
+	data, err := h.queries.Overview(r.Context(), p)
+	if err != nil {
+		logging.InternalError(w, r, "overview query error", err)
+		return
+	}
+
+	writeReport(w, r, "overview", data)
+}
+
+// HandleTimeSeries returns the views over time of one or more values of a
+// dimension: ?dimension=page&value=/blog&value=/about.
+func (h *Handler) HandleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	p := h.params(r)
+	if len(p.Domains) == 0 {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	dimension := r.URL.Query().Get("dimension")
+	if _, ok := dimensions[dimension]; !ok {
+		http.Error(w, "unknown dimension", http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()["value"]
+	if len(values) == 0 || len(values) > maxSeriesValues {
+		http.Error(w, fmt.Sprintf("value is required, at most %d times", maxSeriesValues), http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.queries.TimeSeries(r.Context(), p, dimension, values)
+	if err != nil {
+		logging.InternalError(w, r, "time series query error", err)
+		return
+	}
+
+	writeReport(w, r, "timeseries", data)
+}
+
+func parseParams(r *http.Request) Params {
 	period := r.URL.Query().Get("period")
 
 	days := 30
@@ -143,7 +377,81 @@ func parseParams(r *http.Request) (string, int) {
 		days = 365
 	}
 
-	return domain, days
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// An unknown timezone falls back to the site's, like other bad values.
+	tz := r.URL.Query().Get("tz")
+	if tz != "" && !model.ValidTimezone(tz) {
+		tz = ""
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if _, ok := bucketFormats[interval]; !ok {
+		interval = defaultInterval(days)
+	}
+	interval = coarseInterval(interval, days)
+
+	return Params{
+		Domains:           parseDomains(r.URL.Query()["domain"]),
+		Days:              days,
+		Timezone:          tz,
+		Interval:          interval,
+		ExcludeDatacenter: r.URL.Query().Get("datacenter") == "exclude",
+		Browser:           r.URL.Query().Get("browser"),
+		OS:                r.URL.Query().Get("os"),
+		Source:            r.URL.Query().Get("source"),
+		Hostname:          strings.ToLower(r.URL.Query().Get("hostname")),
+		Limit:             min(limit, maxLimit),
+		Offset:            offset,
+		Sort:              r.URL.Query().Get("sort"),
+		Search:            r.URL.Query().Get("q"),
+	}
+}
+
+// parseDomains reads the domains of a report. Several domains are combined
+// into one site, given as repeated or comma separated domain parameters.
+func parseDomains(values []string) []string {
+	var domains []string
+	for _, v := range values {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d != "" && !slices.Contains(domains, d) {
+				domains = append(domains, d)
+			}
+		}
+	}
+	return domains
+}
+
+// params is parseParams with the domains resolved to the sites they are
+// recorded under, so an alias or www. host shows its site's data. A tz the
+// database doesn't know falls back to the site's, like other bad values.
+func (h *Handler) params(r *http.Request) Params {
+	p := parseParams(r)
+	p.Domains = h.canonicalDomains(r.Context(), p.Domains)
+	if p.Timezone != "" {
+		if known, err := h.knownTimezone(r.Context(), p.Timezone); err != nil || !known {
+			p.Timezone = ""
+		}
+	}
+	return p
+}
+
+func (h *Handler) canonicalDomains(ctx context.Context, domains []string) []string {
+	var out []string
+	for _, d := range domains {
+		if d = h.canonical(ctx, d); !slices.Contains(out, d) {
+			out = append(out, d)
+		}
+	}
+	return out
 }
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -0,0 +1,206 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"visitor/internal/model"
+)
+
+// Overview reports every tracked site over the period of p: the configured
+// sites and any domain with page views in this or the previous period. Each
+// site counts days in its own timezone unless p.Timezone is set. p.Domains
+// is ignored, the filters of p apply to all sites.
+func (q *Queries) Overview(ctx context.Context, p Params) (*model.Overview, error) {
+	domains, err := q.trackedDomains(ctx, p.Days)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &model.Overview{Interval: p.Interval, Sites: []model.SiteOverview{}}
+	if len(domains) == 0 {
+		return out, nil
+	}
+	p.Domains = domains
+
+	index := make(map[string]int, len(domains))
+	for i, domain := range domains {
+		index[domain] = i
+		out.Sites = append(out.Sites, model.SiteOverview{
+			SiteStats: model.SiteStats{Domain: domain},
+			Series:    []model.TimeStat{},
+		})
+	}
+
+	totals, err := q.siteTotals(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range totals {
+		out.Sites[index[t.Domain]].SiteStats = t
+	}
+
+	err = q.siteSeries(ctx, p, func(domain string, t model.TimeStat) {
+		site := &out.Sites[index[domain]]
+		site.Series = append(site.Series, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// overviewSites lists the domains of p as "s" with the timezone, local start
+// of the period and local date of today of each, so one query can cut every
+// site's days in its own timezone. Its columns don't clash with those of
+// page_views and imported_daily, so where clauses can join it unqualified.
+const overviewSites = `WITH s AS (
+		SELECT site, tz,
+		  date_trunc('day', NOW() AT TIME ZONE tz) - make_interval(days => $2 - 1) AS local_start,
+		  (NOW() AT TIME ZONE tz)::date AS today
+		FROM unnest($1::text[]) AS d(site)
+		CROSS JOIN LATERAL (
+		  SELECT COALESCE(NULLIF($3, ''), (SELECT timezone FROM sites WHERE sites.domain = d.site), 'UTC') AS tz
+		) z
+	)
+	`
+
+// importedSiteDays is importedDays per domain, joined to overviewSites.
+const importedSiteDays = `SELECT domain, date,
+		CASE WHEN bool_or(path = '') THEN SUM(views) FILTER (WHERE path = '') ELSE SUM(views) END AS views,
+		CASE WHEN bool_or(path = '') THEN SUM(visitors) FILTER (WHERE path = '') ELSE SUM(visitors) END AS visitors
+	FROM imported_daily JOIN s ON s.site = domain
+	WHERE %s
+	GROUP BY domain, date`
+
+// siteTotals returns the views and visitors of each site of p in the period
+// and its views in the period before, imported rollups included.
+func (q *Queries) siteTotals(ctx context.Context, p Params) ([]model.SiteStats, error) {
+	where, args := p.whereDuring("created_at >= (s.local_start AT TIME ZONE s.tz)")
+	previousWhere, _ := p.whereDuring(
+		"created_at >= ((s.local_start - make_interval(days => $2)) AT TIME ZONE s.tz) AND created_at < (s.local_start AT TIME ZONE s.tz)")
+	imported := fmt.Sprintf(importedSiteDays, p.importedWhereDuring("date > s.today - $2::int"))
+	previousImported := fmt.Sprintf(importedSiteDays,
+		p.importedWhereDuring("date > s.today - 2 * $2::int AND date <= s.today - $2::int"))
+
+	rows, err := q.pool.Query(ctx, overviewSites+`
+		SELECT s.site,
+		  (COALESCE(c.views, 0) + COALESCE(i.views, 0))::bigint,
+		  (COALESCE(c.visitors, 0) + COALESCE(i.visitors, 0))::bigint,
+		  (COALESCE(pc.views, 0) + COALESCE(pic.views, 0))::bigint
+		FROM s
+		LEFT JOIN (
+		  SELECT domain, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		  FROM page_views JOIN s ON s.site = domain
+		  WHERE `+where+`
+		  GROUP BY domain
+		) c ON c.domain = s.site
+		LEFT JOIN (
+		  SELECT domain, SUM(views) AS views, SUM(visitors) AS visitors
+		  FROM (`+imported+`) d
+		  GROUP BY domain
+		) i ON i.domain = s.site
+		LEFT JOIN (
+		  SELECT domain, COUNT(*) AS views
+		  FROM page_views JOIN s ON s.site = domain
+		  WHERE `+previousWhere+`
+		  GROUP BY domain
+		) pc ON pc.domain = s.site
+		LEFT JOIN (
+		  SELECT domain, SUM(views) AS views
+		  FROM (`+previousImported+`) d
+		  GROUP BY domain
+		) pic ON pic.domain = s.site
+		ORDER BY s.site`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("overview totals: %w", err)
+	}
+	defer rows.Close()
+
+	var out []model.SiteStats
+	for rows.Next() {
+		var t model.SiteStats
+		if err := rows.Scan(&t.Domain, &t.Views, &t.Visitors, &t.PreviousViews); err != nil {
+			return nil, fmt.Errorf("scan overview totals: %w", err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// siteSeries is series for every site of p at once. It calls add with each
+// bucket, in order of site and time.
+func (q *Queries) siteSeries(ctx context.Context, p Params, add func(domain string, t model.TimeStat)) error {
+	interval := p.Interval
+	format, ok := bucketFormats[interval]
+	if !ok {
+		return fmt.Errorf("unknown interval %q", interval)
+	}
+
+	where, args := p.whereDuring("created_at >= (s.local_start AT TIME ZONE s.tz)")
+	imported := fmt.Sprintf(importedSiteDays, p.importedWhereDuring("date > s.today - $2::int"))
+
+	local := bucket(interval)
+	rows, err := q.pool.Query(ctx, overviewSites+`
+		SELECT s.site, to_char(b.bucket, '`+format+`'), COALESCE(SUM(c.views), 0)::bigint, COALESCE(SUM(c.visitors), 0)::bigint
+		FROM s
+		CROSS JOIN LATERAL generate_series(
+		  `+fmt.Sprintf(local, "s.local_start")+`,
+		  `+fmt.Sprintf(local, "NOW() AT TIME ZONE s.tz")+`,
+		  interval '1 `+interval+`'
+		) AS b(bucket)
+		LEFT JOIN (
+		  SELECT domain, `+fmt.Sprintf(local, "created_at AT TIME ZONE s.tz")+` AS bucket,
+		    COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		  FROM page_views JOIN s ON s.site = domain
+		  WHERE `+where+`
+		  GROUP BY 1, 2
+		  UNION ALL
+		  SELECT i.domain, `+fmt.Sprintf(local, "i.date::timestamp")+`, i.views, i.visitors
+		  FROM (`+imported+`) i
+		) c ON c.domain = s.site AND c.bucket = b.bucket
+		GROUP BY s.site, b.bucket
+		ORDER BY s.site, b.bucket`,
+		args...)
+	if err != nil {
+		return fmt.Errorf("overview series: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain string
+		var t model.TimeStat
+		if err := rows.Scan(&domain, &t.Start, &t.Views, &t.Visitors); err != nil {
+			return fmt.Errorf("scan overview series: %w", err)
+		}
+		add(domain, t)
+	}
+	return rows.Err()
+}
+
+// trackedDomains returns the configured sites and the domains seen in the
+// last 2*days days, a day of slack covers any timezone.
+func (q *Queries) trackedDomains(ctx context.Context, days int) ([]string, error) {
+	rows, err := q.pool.Query(ctx,
+		`SELECT domain FROM sites
+		 UNION
+		 SELECT DISTINCT domain FROM page_views WHERE created_at >= NOW() - make_interval(days => 2 * $1 + 1)
+		 UNION
+		 SELECT DISTINCT domain FROM imported_daily WHERE date >= CURRENT_DATE - (2 * $1 + 1)
+		 ORDER BY domain`,
+		days)
+	if err != nil {
+		return nil, fmt.Errorf("tracked domains: %w", err)
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, fmt.Errorf("scan tracked domain: %w", err)
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
@@ -3,6 +3,7 @@ package dashboard
 import (
 	"context"
 	"fmt"
+	"strings"
 	"visitor/internal/model"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,196 +17,496 @@ func NewQueries(pool *pgxpool.Pool) *Queries {
 	return &Queries{pool: pool}
 }
 
-func (q *Queries) Summary(ctx context.Context, domain string, days int) (*model.SummaryStats, error) {
-	stats := &model.SummaryStats{}
+// Params selects the page views a report is computed over.
+type Params struct {
+	// Domains are reported on as one combined site.
+	Domains           []string
+	Days              int
+	ExcludeDatacenter bool
+	Browser           string
+	OS                string
+	Source            string
+	Hostname          string
 
-	err := q.pool.QueryRow(ctx, `SELECT COUNT(*), COUNT(DISTINCT visitor_hash)
-								FROM page_views
-								WHERE domain = $1 AND created_at >= NOW() - make_interval(days => $2)`,
-							domain, days).Scan(&stats.TotalViews, &stats.UniqueVisitors)
-	if err != nil {
-		return nil, fmt.Errorf("summary totals: %w", err)
-	}
+	// Timezone overrides the site's timezone for days and periods.
+	Timezone string
+	// Interval is the bucket size of time series: hour, day, week or month.
+	Interval string
 
-	rows, err := q.pool.Query(ctx, 
-							`SELECT created_at::date::text AS date,
-							COUNT(*) AS views,
-							COUNT(DISTINCT visitor_hash) AS visitors
-							FROM page_views
-							WHERE domain = $1 AND created_at >= NOW() - make_interval(days => $2)
-							GROUP BY created_at::date
-							ORDER BY created_at::date`, domain, days)
-	if err != nil {
-		return nil, fmt.Errorf("daily stats: %w", err)
-	}	
+	// Paging of breakdown reports.
+	Limit  int
+	Offset int
+	Sort   string // "views", "visitors" or "name"
+	Search string // substring of the row label
+}
 
-	defer rows.Close()
+// Sort orders of breakdown reports, ties are broken by label.
+var sortOrders = map[string]string{
+	"views":    "views DESC",
+	"visitors": "visitors DESC",
+	"name":     "label ASC",
+}
 
-	for rows.Next() {
-		var d model.DailyStat
-		if err := rows.Scan(&d.Date, &d.Views, &d.Visitors); err != nil {
-			return nil, fmt.Errorf("scan daily stat: %w", err)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// reportTZ is the timezone of a report: the tz parameter ($3), else the
+// setting of the first site, else UTC.
+const reportTZ = `COALESCE(NULLIF($3, ''), (SELECT timezone FROM sites WHERE sites.domain = ($1::text[])[1]), 'UTC')`
+
+// localPeriodStart is local midnight $2 - 1 days ago, so a period of one
+// day is today.
+const localPeriodStart = `(date_trunc('day', NOW() AT TIME ZONE ` + reportTZ + `) - make_interval(days => $2 - 1))`
+
+// periodStart is localPeriodStart as an instant. Going through local time
+// keeps the boundary right across DST changes.
+const periodStart = `(` + localPeriodStart + ` AT TIME ZONE ` + reportTZ + `)`
+
+// previousPeriodStart is the start of the period of the same length before
+// the current one.
+const previousPeriodStart = `((` + localPeriodStart + ` - make_interval(days => $2)) AT TIME ZONE ` + reportTZ + `)`
+
+// localToday is the current date in the report's timezone.
+const localToday = `(NOW() AT TIME ZONE ` + reportTZ + `)::date`
+
+// Time series intervals, see Params.Interval.
+const (
+	intervalHour  = "hour"
+	intervalDay   = "day"
+	intervalWeek  = "week"
+	intervalMonth = "month"
+)
+
+// bucketFormats renders the local start of a bucket per interval.
+var bucketFormats = map[string]string{
+	intervalHour:  `YYYY-MM-DD"T"HH24:MI`,
+	intervalDay:   `YYYY-MM-DD`,
+	intervalWeek:  `YYYY-MM-DD`,
+	intervalMonth: `YYYY-MM-DD`,
+}
+
+// maxBuckets caps the buckets of one time series, see coarseInterval.
+const maxBuckets = 400
+
+// intervalDays is the approximate length of each interval in days, from the
+// finest to the coarsest.
+var intervalDays = []struct {
+	interval string
+	days     float64
+}{
+	{intervalHour, 1.0 / 24},
+	{intervalDay, 1},
+	{intervalWeek, 7},
+	{intervalMonth, 30},
+}
+
+// coarseInterval returns interval, or the next coarser one when a period of
+// days would have more than maxBuckets buckets, e.g. days for 12 months
+// requested by the hour.
+func coarseInterval(interval string, days int) string {
+	coarser := false
+	for _, i := range intervalDays {
+		if i.interval == interval {
+			coarser = true
+		}
+		if coarser && float64(days)/i.days <= maxBuckets {
+			return i.interval
 		}
-		stats.ViewsPerDay = append(stats.ViewsPerDay, d)
 	}
+	return intervalMonth
+}
 
-	return stats, rows.Err()
+// defaultInterval picks the time series interval for a period.
+func defaultInterval(days int) string {
+	switch {
+	case days <= 1:
+		return intervalHour
+	case days <= 90:
+		return intervalDay
+	default:
+		return intervalMonth
+	}
 }
 
-func (q *Queries) Pages(ctx context.Context, domain string, days int) ([]model.PageStats, error) {
-	rows, err := q.pool.Query(ctx,
-		`SELECT path, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
-		 FROM page_views
-		 WHERE domain = $1 AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY path
-		 ORDER BY views DESC
-		 LIMIT 20`,
-		domain, days)
-	if err != nil {
-		return nil, fmt.Errorf("top pages: %w", err)
+// args returns the arguments every report query starts with: the domains,
+// the number of days and the timezone override.
+func (p Params) args() []any {
+	return []any{p.domains(), p.Days, p.Timezone}
+}
+
+// domains returns the domains as a non-nil slice, which pgx encodes as an
+// empty array rather than NULL.
+func (p Params) domains() []string {
+	if p.Domains == nil {
+		return []string{}
 	}
-	defer rows.Close()
+	return p.Domains
+}
 
-	var pages []model.PageStats
-	for rows.Next() {
-		var p model.PageStats
-		if err := rows.Scan(&p.Path, &p.Views, &p.Visitors); err != nil {
-			return nil, fmt.Errorf("scan page: %w", err)
-		}
-		pages = append(pages, p)
+// where returns the SQL condition matching p along with its arguments.
+// Callers may append further arguments starting at $len(args)+1.
+func (p Params) where() (string, []any) {
+	return p.whereDuring("created_at >= " + periodStart)
+}
+
+// whereDuring is where with the period replaced by the condition on
+// created_at in period.
+func (p Params) whereDuring(period string) (string, []any) {
+	clause := "domain = ANY($1) AND " + period
+	args := p.args()
+	if p.ExcludeDatacenter {
+		clause += " AND NOT is_datacenter"
+	}
+	if p.Browser != "" {
+		args = append(args, p.Browser)
+		clause += fmt.Sprintf(" AND browser = $%d", len(args))
+	}
+	if p.OS != "" {
+		args = append(args, p.OS)
+		clause += fmt.Sprintf(" AND os = $%d", len(args))
+	}
+	if p.Source != "" {
+		args = append(args, p.Source)
+		clause += fmt.Sprintf(" AND referrer_source = $%d", len(args))
 	}
+	if p.Hostname != "" {
+		args = append(args, p.Hostname)
+		clause += fmt.Sprintf(" AND hostname = $%d", len(args))
+	}
+	return clause, args
+}
 
-	return pages, rows.Err()
+// search narrows a grouped report query, whose first column is "label", to
+// the rows matching p.Search.
+func (p Params) search(query string, args []any) (string, []any) {
+	if p.Search == "" {
+		return query, args
+	}
+	args = append(args, "%"+likeEscaper.Replace(p.Search)+"%")
+	return fmt.Sprintf("SELECT * FROM (%s) r WHERE label ILIKE $%d", query, len(args)), args
 }
 
-func (q *Queries) Referrers(ctx context.Context, domain string, days int) ([]model.ReferrerStats, error) {
-	rows, err := q.pool.Query(ctx,
-		`SELECT referrer, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
-		 FROM page_views
-		 WHERE domain = $1 AND referrer != '' AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY referrer
-		 ORDER BY views DESC
-		 LIMIT 20`,
-		domain, days)
+// page sorts and pages a searched report query and appends the total number
+// of rows as the last column.
+func (p Params) page(query string, args []any) (string, []any) {
+	order, ok := sortOrders[p.Sort]
+	if !ok {
+		order = sortOrders["views"]
+	}
+	args = append(args, p.Limit, p.Offset)
+	return fmt.Sprintf(`SELECT *, COUNT(*) OVER () AS total FROM (%s) r
+		ORDER BY %s, label
+		LIMIT $%d OFFSET $%d`, query, order, len(args)-1, len(args)), args
+}
+
+// breakdown runs a grouped report query through search and paging. scan
+// returns the scan targets of a row, the total is read after them.
+func breakdown[T any](ctx context.Context, q *Queries, p Params, name, query string, args []any, scan func(*T) []any) (*model.Breakdown[T], error) {
+	query, args = p.search(query, args)
+	paged, pagedArgs := p.page(query, args)
+
+	rows, err := q.pool.Query(ctx, paged, pagedArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("top referrers: %w", err)
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 	defer rows.Close()
 
-	var refs []model.ReferrerStats
+	out := &model.Breakdown[T]{Rows: []T{}}
 	for rows.Next() {
-		var r model.ReferrerStats
-		if err := rows.Scan(&r.Referrer, &r.Views, &r.Visitors); err != nil {
-			return nil, fmt.Errorf("scan referrer: %w", err)
+		var row T
+		if err := rows.Scan(append(scan(&row), &out.Total)...); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", name, err)
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// A page past the end has no row to read the total from.
+	if len(out.Rows) == 0 && p.Offset > 0 {
+		err := q.pool.QueryRow(ctx, "SELECT COUNT(*) FROM ("+query+") r", args...).Scan(&out.Total)
+		if err != nil {
+			return nil, fmt.Errorf("count %s: %w", name, err)
 		}
-		refs = append(refs, r)
 	}
+	return out, nil
+}
 
-	return refs, rows.Err()
+// importedWhere returns the condition for imported_daily rows, sharing $1
+// to $3 with where. Imported rollups carry no dimensions, so any filter
+// leaves them out.
+func (p Params) importedWhere() string {
+	return p.importedWhereDuring("date > " + localToday + " - $2::int")
 }
 
-func (q *Queries) Locations(ctx context.Context, domain string, days int) ([]model.DimensionStats, error) {
-	rows, err := q.pool.Query(ctx,
-		`SELECT country_code, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
-		 FROM page_views
-		 WHERE domain = $1 AND country_code != '' AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY country_code
-		 ORDER BY views DESC
-		 LIMIT 20`,
-		domain, days)
+// importedWhereDuring is importedWhere with the period replaced by the
+// condition on date in period.
+func (p Params) importedWhereDuring(period string) string {
+	if p.ExcludeDatacenter || p.Browser != "" || p.OS != "" || p.Source != "" || p.Hostname != "" {
+		return "FALSE"
+	}
+	return "domain = ANY($1) AND " + period
+}
+
+// importedDays sums imported rollups per day. Site totals (empty path) win over
+// the sum of the day's pages, which counts a visitor once per page.
+const importedDays = `SELECT date,
+		CASE WHEN bool_or(path = '') THEN SUM(views) FILTER (WHERE path = '') ELSE SUM(views) END AS views,
+		CASE WHEN bool_or(path = '') THEN SUM(visitors) FILTER (WHERE path = '') ELSE SUM(visitors) END AS visitors
+	FROM imported_daily
+	WHERE %s
+	GROUP BY date`
+
+func (q *Queries) Summary(ctx context.Context, p Params) (*model.SummaryStats, error) {
+	stats := &model.SummaryStats{}
+	where, args := p.where()
+
+	imported := fmt.Sprintf(importedDays, p.importedWhere())
+
+	err := q.pool.QueryRow(ctx, `SELECT
+								(SELECT COUNT(*) FROM page_views WHERE `+where+`) + COALESCE(SUM(views), 0)::bigint,
+								(SELECT COUNT(DISTINCT visitor_hash) FROM page_views WHERE `+where+`) + COALESCE(SUM(visitors), 0)::bigint
+								FROM (`+imported+`) i`,
+							args...).Scan(&stats.TotalViews, &stats.UniqueVisitors)
 	if err != nil {
-		return nil, fmt.Errorf("top locations: %w", err)
+		return nil, fmt.Errorf("summary totals: %w", err)
 	}
-	defer rows.Close()
 
-	var out []model.DimensionStats
-	for rows.Next() {
-		var d model.DimensionStats
-		if err := rows.Scan(&d.Label, &d.Views, &d.Visitors); err != nil {
-			return nil, fmt.Errorf("scan location: %w", err)
-		}
-		out = append(out, d)
+	stats.VisitorsPerDomain = len(p.Domains) > 1
+	stats.Interval = p.Interval
+	stats.Series, err = q.series(ctx, p, where, args, imported)
+	if err != nil {
+		return nil, err
 	}
-	return out, rows.Err()
+
+	return stats, nil
+}
+
+// bucket returns a format string truncating a local timestamp to the start
+// of its interval.
+func bucket(interval string) string {
+	return `date_trunc('` + interval + `', %s)`
+}
+
+// buckets generates the local start of every bucket in the period.
+func buckets(interval string) string {
+	local := bucket(interval)
+	return `generate_series(
+		   ` + fmt.Sprintf(local, localPeriodStart) + `,
+		   ` + fmt.Sprintf(local, `NOW() AT TIME ZONE `+reportTZ) + `,
+		   interval '1 ` + interval + `'
+		 )`
 }
 
-func (q *Queries) Sizes(ctx context.Context, domain string, days int) ([]model.DimensionStats, error) {
+// series buckets the page views matching where, plus the imported days if
+// given, by p.Interval. Buckets are cut in local time and the whole period
+// is covered, empty buckets count zero.
+func (q *Queries) series(ctx context.Context, p Params, where string, args []any, imported string) ([]model.TimeStat, error) {
+	interval := p.Interval
+	format, ok := bucketFormats[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %q", interval)
+	}
+
+	local := bucket(interval)
+	counts := `SELECT ` + fmt.Sprintf(local, `created_at AT TIME ZONE `+reportTZ) + ` AS bucket,
+		  COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		FROM page_views
+		WHERE ` + where + `
+		GROUP BY 1`
+	if imported != "" {
+		counts += `
+		UNION ALL
+		SELECT ` + fmt.Sprintf(local, `i.date::timestamp`) + `, i.views, i.visitors
+		FROM (` + imported + `) i`
+	}
+
 	rows, err := q.pool.Query(ctx,
-		`SELECT
-		   CASE
-		     WHEN screen_size = '' THEN 'Unknown'
-		     WHEN SPLIT_PART(screen_size, 'x', 1)::int <= 768 THEN 'Mobile'
-		     WHEN SPLIT_PART(screen_size, 'x', 1)::int <= 1024 THEN 'Tablet / Large Phone'
-		     ELSE 'Computer Monitor'
-		   END AS size_category,
-		   COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
-		 FROM page_views
-		 WHERE domain = $1 AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY size_category
-		 ORDER BY views DESC`,
-		domain, days)
+		`SELECT to_char(b.bucket, '`+format+`'), COALESCE(SUM(c.views), 0)::bigint, COALESCE(SUM(c.visitors), 0)::bigint
+		 FROM `+buckets(interval)+` AS b(bucket)
+		 LEFT JOIN (`+counts+`) c ON c.bucket = b.bucket
+		 GROUP BY b.bucket
+		 ORDER BY b.bucket`,
+		args...)
 	if err != nil {
-		return nil, fmt.Errorf("sizes: %w", err)
+		return nil, fmt.Errorf("time series: %w", err)
 	}
 	defer rows.Close()
 
-	var out []model.DimensionStats
+	series := []model.TimeStat{}
 	for rows.Next() {
-		var d model.DimensionStats
-		if err := rows.Scan(&d.Label, &d.Views, &d.Visitors); err != nil {
-			return nil, fmt.Errorf("scan size: %w", err)
+		var t model.TimeStat
+		if err := rows.Scan(&t.Start, &t.Views, &t.Visitors); err != nil {
+			return nil, fmt.Errorf("scan time series: %w", err)
 		}
-		out = append(out, d)
+		series = append(series, t)
 	}
-	return out, rows.Err()
+	return series, rows.Err()
 }
 
-func (q *Queries) Browsers(ctx context.Context, domain string, days int) ([]model.DimensionStats, error) {
-	rows, err := q.pool.Query(ctx,
-		`SELECT browser, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+func (q *Queries) Pages(ctx context.Context, p Params) (*model.Breakdown[model.PageStats], error) {
+	where, args := p.where()
+	return breakdown(ctx, q, p, "top pages",
+		`SELECT path AS label, SUM(views)::bigint AS views, SUM(visitors)::bigint AS visitors,
+		   COALESCE(MAX(avg_scroll_depth), 0)::int AS avg_scroll_depth,
+		   COALESCE(MAX(avg_time_on_page), 0)::int AS avg_time_on_page
+		 FROM (
+		   SELECT path, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors,
+		     ROUND(AVG(scroll_depth)) AS avg_scroll_depth,
+		     ROUND(AVG(engagement_ms) / 1000) AS avg_time_on_page
+		   FROM page_views
+		   WHERE `+where+`
+		   GROUP BY path
+		   UNION ALL
+		   SELECT path, SUM(views), SUM(visitors), NULL, NULL
+		   FROM imported_daily
+		   WHERE `+p.importedWhere()+` AND path != ''
+		   GROUP BY path
+		 ) t
+		 GROUP BY path`,
+		args, func(ps *model.PageStats) []any {
+			return []any{&ps.Path, &ps.Views, &ps.Visitors, &ps.AvgScrollDepth, &ps.AvgTimeOnPage}
+		})
+}
+
+// Sources returns the top referrer sources, e.g. "Google" or "Hacker News".
+// Drill into a source by setting p.Source and calling Referrers.
+func (q *Queries) Sources(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "referrer_source", "sources")
+}
+
+// Channels breaks traffic down into Direct, Organic Search, Social, etc.
+func (q *Queries) Channels(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "channel", "channels")
+}
+
+func (q *Queries) Referrers(ctx context.Context, p Params) (*model.Breakdown[model.ReferrerStats], error) {
+	where, args := p.where()
+	return breakdown(ctx, q, p, "top referrers",
+		`SELECT referrer AS label, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
 		 FROM page_views
-		 WHERE domain = $1 AND browser != '' AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY browser
-		 ORDER BY views DESC
-		 LIMIT 20`,
-		domain, days)
-	if err != nil {
-		return nil, fmt.Errorf("browsers: %w", err)
+		 WHERE `+where+` AND referrer != ''
+		 GROUP BY referrer`,
+		args, func(r *model.ReferrerStats) []any {
+			return []any{&r.Referrer, &r.Views, &r.Visitors}
+		})
+}
+
+func (q *Queries) Locations(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "country_code", "locations")
+}
+
+// sizeCategory groups screen widths into device classes.
+const sizeCategory = `CASE
+		WHEN screen_size = '' THEN 'Unknown'
+		WHEN SPLIT_PART(screen_size, 'x', 1)::int <= 768 THEN 'Mobile'
+		WHEN SPLIT_PART(screen_size, 'x', 1)::int <= 1024 THEN 'Tablet / Large Phone'
+		ELSE 'Computer Monitor'
+	END`
+
+func (q *Queries) Sizes(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, sizeCategory, "sizes")
+}
+
+// Browsers returns the top browsers, or the versions of p.Browser when set.
+func (q *Queries) Browsers(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	if p.Browser != "" {
+		return q.dimension(ctx, p, "browser_version", "browser versions")
 	}
-	defer rows.Close()
+	return q.dimension(ctx, p, "browser", "browsers")
+}
 
-	var out []model.DimensionStats
-	for rows.Next() {
-		var d model.DimensionStats
-		if err := rows.Scan(&d.Label, &d.Views, &d.Visitors); err != nil {
-			return nil, fmt.Errorf("scan browser: %w", err)
-		}
-		out = append(out, d)
+// Systems returns the top operating systems, or the versions of p.OS when set.
+func (q *Queries) Systems(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	if p.OS != "" {
+		return q.dimension(ctx, p, "os_version", "os versions")
 	}
-	return out, rows.Err()
+	return q.dimension(ctx, p, "os", "systems")
+}
+
+func (q *Queries) UTMSources(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "utm_source", "utm sources")
+}
+
+func (q *Queries) UTMMediums(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "utm_medium", "utm mediums")
+}
+
+func (q *Queries) UTMCampaigns(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "utm_campaign", "utm campaigns")
+}
+
+func (q *Queries) Devices(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "device_type", "devices")
+}
+
+func (q *Queries) Networks(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "asn_org", "networks")
+}
+
+// Hosts returns the hostnames page views happened on, which tells apart the
+// subdomains and aliases of a site. Filter on one with p.Hostname.
+func (q *Queries) Hosts(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.dimension(ctx, p, "hostname", "hosts")
+}
+
+func (q *Queries) Outbound(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.linkEvents(ctx, p, model.EventOutbound)
+}
+
+func (q *Queries) Downloads(ctx context.Context, p Params) (*model.Breakdown[model.DimensionStats], error) {
+	return q.linkEvents(ctx, p, model.EventDownload)
 }
 
-func (q *Queries) Systems(ctx context.Context, domain string, days int) ([]model.DimensionStats, error) {
+// linkEvents returns the URLs clicked for the given link event type. Page
+// view filters such as browser or source don't apply to link events.
+func (q *Queries) linkEvents(ctx context.Context, p Params, eventType string) (*model.Breakdown[model.DimensionStats], error) {
+	return breakdown(ctx, q, p, eventType+" links",
+		`SELECT url AS label, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		 FROM link_events
+		 WHERE domain = ANY($1) AND created_at >= `+periodStart+` AND type = $4
+		 GROUP BY url`,
+		append(p.args(), eventType), scanDimension)
+}
+
+// Filtered returns the number of hits dropped at ingestion per day and reason.
+// Hits are stored per day in the site's timezone, so the tz parameter only
+// moves the period, not the days.
+func (q *Queries) Filtered(ctx context.Context, p Params) ([]model.FilteredStat, error) {
 	rows, err := q.pool.Query(ctx,
-		`SELECT os, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
-		 FROM page_views
-		 WHERE domain = $1 AND os != '' AND created_at >= NOW() - make_interval(days => $2)
-		 GROUP BY os
-		 ORDER BY views DESC
-		 LIMIT 20`,
-		domain, days)
+		`SELECT date::text, reason, SUM(hits)::bigint
+		 FROM filtered_hits
+		 WHERE domain = ANY($1) AND date > `+localToday+` - $2::int
+		 GROUP BY date, reason
+		 ORDER BY date, reason`,
+		p.args()...)
 	if err != nil {
-		return nil, fmt.Errorf("systems: %w", err)
+		return nil, fmt.Errorf("filtered hits: %w", err)
 	}
 	defer rows.Close()
 
-	var out []model.DimensionStats
+	var out []model.FilteredStat
 	for rows.Next() {
-		var d model.DimensionStats
-		if err := rows.Scan(&d.Label, &d.Views, &d.Visitors); err != nil {
-			return nil, fmt.Errorf("scan system: %w", err)
+		var f model.FilteredStat
+		if err := rows.Scan(&f.Date, &f.Reason, &f.Hits); err != nil {
+			return nil, fmt.Errorf("scan filtered hit: %w", err)
 		}
-		out = append(out, d)
+		out = append(out, f)
 	}
 	return out, rows.Err()
 }
+
+// dimension returns the values of column, skipping empty ones.
+func (q *Queries) dimension(ctx context.Context, p Params, column string, name string) (*model.Breakdown[model.DimensionStats], error) {
+	where, args := p.where()
+	return breakdown(ctx, q, p, name,
+		`SELECT `+column+` AS label, COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		 FROM page_views
+		 WHERE `+where+` AND `+column+` != ''
+		 GROUP BY `+column,
+		args, scanDimension)
+}
+
+func scanDimension(d *model.DimensionStats) []any {
+	return []any{&d.Label, &d.Views, &d.Visitors}
+}
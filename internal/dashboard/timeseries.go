@@ -0,0 +1,105 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"visitor/internal/model"
+)
+
+// maxSeriesValues caps the values of one time series request.
+const maxSeriesValues = 20
+
+// dimensions maps the dimension names of the timeseries endpoint to their
+// page_views column.
+var dimensions = map[string]string{
+	"domain":          "domain",
+	"hostname":        "hostname",
+	"page":            "path",
+	"referrer":        "referrer",
+	"source":          "referrer_source",
+	"channel":         "channel",
+	"country":         "country_code",
+	"size":            sizeCategory,
+	"browser":         "browser",
+	"browser_version": "browser_version",
+	"os":              "os",
+	"os_version":      "os_version",
+	"device":          "device_type",
+	"network":         "asn_org",
+	"utm_source":      "utm_source",
+	"utm_medium":      "utm_medium",
+	"utm_campaign":    "utm_campaign",
+	"utm_term":        "utm_term",
+	"utm_content":     "utm_content",
+}
+
+// TimeSeries buckets the views of each value of a dimension by p.Interval,
+// within the filters of p. Values come back in the order given.
+func (q *Queries) TimeSeries(ctx context.Context, p Params, dimension string, values []string) (*model.TimeSeries, error) {
+	column, ok := dimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+	format, ok := bucketFormats[p.Interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %q", p.Interval)
+	}
+
+	// Series are told apart by value, so each may only appear once.
+	seen := make(map[string]bool, len(values))
+	unique := values[:0:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	where, args := p.where()
+	args = append(args, unique)
+	valuesArg := fmt.Sprintf("$%d::text[]", len(args))
+
+	local := bucket(p.Interval)
+	counts := `SELECT ` + column + ` AS value, ` + fmt.Sprintf(local, `created_at AT TIME ZONE `+reportTZ) + ` AS bucket,
+		  COUNT(*) AS views, COUNT(DISTINCT visitor_hash) AS visitors
+		FROM page_views
+		WHERE ` + where + ` AND ` + column + ` = ANY(` + valuesArg + `)
+		GROUP BY 1, 2`
+	// Imported rollups only know pages.
+	if dimension == "page" {
+		counts += `
+		UNION ALL
+		SELECT path, ` + fmt.Sprintf(local, `date::timestamp`) + `, views, visitors
+		FROM imported_daily
+		WHERE ` + p.importedWhere() + ` AND path = ANY(` + valuesArg + `)`
+	}
+
+	rows, err := q.pool.Query(ctx,
+		`SELECT v.value, to_char(b.bucket, '`+format+`'), COALESCE(SUM(c.views), 0)::bigint, COALESCE(SUM(c.visitors), 0)::bigint
+		 FROM unnest(`+valuesArg+`) WITH ORDINALITY AS v(value, n)
+		 CROSS JOIN `+buckets(p.Interval)+` AS b(bucket)
+		 LEFT JOIN (`+counts+`) c ON c.value = v.value AND c.bucket = b.bucket
+		 GROUP BY v.n, v.value, b.bucket
+		 ORDER BY v.n, b.bucket`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("time series: %w", err)
+	}
+	defer rows.Close()
+
+	ts := &model.TimeSeries{Dimension: dimension, Interval: p.Interval, Values: []model.ValueSeries{}}
+	for rows.Next() {
+		var value string
+		var t model.TimeStat
+		if err := rows.Scan(&value, &t.Start, &t.Views, &t.Visitors); err != nil {
+			return nil, fmt.Errorf("scan time series: %w", err)
+		}
+
+		if n := len(ts.Values); n == 0 || ts.Values[n-1].Value != value {
+			ts.Values = append(ts.Values, model.ValueSeries{Value: value})
+		}
+		last := &ts.Values[len(ts.Values)-1]
+		last.Series = append(last.Series, t)
+	}
+	return ts, rows.Err()
+}
@@ -1,30 +1,45 @@
 package geoip
 
 import (
-	"log"
+	"log/slog"
 	"net"
 
 	"github.com/oschwald/geoip2-golang"
 )
 
 type Resolver struct {
-	db *geoip2.Reader
+	db  *geoip2.Reader
+	asn *geoip2.Reader
 }
 
-func New(path string) *Resolver {
+// Network describes the autonomous system an IP address belongs to.
+type Network struct {
+	ASN          uint
+	Organization string
+	Hosting      bool
+}
+
+func New(path string, asnPath string) *Resolver {
+	return &Resolver{
+		db:  open(path, "country detection"),
+		asn: open(asnPath, "ASN detection"),
+	}
+}
+
+func open(path string, feature string) *geoip2.Reader {
 	if path == "" {
-		log.Println("GeoIP: no database path configured, country detection disabled")
-		return &Resolver{}
+		slog.Info("GeoIP: no database path configured", "disabled", feature)
+		return nil
 	}
 
 	db, err := geoip2.Open(path)
 	if err != nil {
-		log.Printf("GeoIP: failed to open %s: %v (country detection disabled)", path, err)
-		return &Resolver{}
+		slog.Warn("GeoIP: failed to open database", "path", path, "err", err, "disabled", feature)
+		return nil
 	}
 
-	log.Printf("GeoIP: loaded database from %s", path)
-	return &Resolver{db: db}
+	slog.Info("GeoIP: loaded database", "path", path)
+	return db
 }
 
 func (r *Resolver) Country(ipStr string) string {
@@ -45,8 +60,35 @@ func (r *Resolver) Country(ipStr string) string {
 	return record.Country.IsoCode
 }
 
+// Network resolves the ASN and organization for ipStr. It returns the zero
+// Network when no ASN database is loaded or the address is unknown.
+func (r *Resolver) Network(ipStr string) Network {
+	if r.asn == nil {
+		return Network{}
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return Network{}
+	}
+
+	record, err := r.asn.ASN(ip)
+	if err != nil || record.AutonomousSystemNumber == 0 {
+		return Network{}
+	}
+
+	return Network{
+		ASN:          record.AutonomousSystemNumber,
+		Organization: record.AutonomousSystemOrganization,
+		Hosting:      IsHosting(record.AutonomousSystemNumber, record.AutonomousSystemOrganization),
+	}
+}
+
 func (r *Resolver) Close() {
 	if r.db != nil {
 		r.db.Close()
 	}
-}
\ No newline at end of file
+	if r.asn != nil {
+		r.asn.Close()
+	}
+}
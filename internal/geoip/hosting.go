@@ -0,0 +1,68 @@
+package geoip
+
+import "strings"
+
+// hostingASNs lists autonomous systems operated by cloud and hosting
+// providers. Traffic from these networks is almost always servers, not people.
+var hostingASNs = map[uint]bool{
+	7224:   true, // Amazon
+	8987:   true, // Amazon
+	14618:  true, // Amazon
+	16509:  true, // Amazon
+	396982: true, // Google Cloud
+	19527:  true, // Google
+	8075:   true, // Microsoft Azure
+	8068:   true, // Microsoft
+	31898:  true, // Oracle Cloud
+	14061:  true, // DigitalOcean
+	24940:  true, // Hetzner
+	213230: true, // Hetzner Cloud
+	16276:  true, // OVH
+	63949:  true, // Linode / Akamai
+	20473:  true, // Vultr
+	12876:  true, // Scaleway
+	51167:  true, // Contabo
+	45102:  true, // Alibaba Cloud
+	132203: true, // Tencent Cloud
+	136907: true, // Huawei Cloud
+	36351:  true, // IBM Cloud / SoftLayer
+	46606:  true, // Unified Layer
+	26496:  true, // GoDaddy
+	8560:   true, // IONOS
+	197540: true, // netcup
+	60781:  true, // LeaseWeb
+	28753:  true, // LeaseWeb
+	30633:  true, // LeaseWeb
+	9009:   true, // M247
+	62567:  true, // DigitalOcean
+	202425: true, // IP Volume
+	40021:  true, // Contabo US
+}
+
+// hostingKeywords catch smaller providers missing from hostingASNs. CDNs
+// such as Cloudflare, Fastly and Akamai are deliberately left out since
+// iCloud Private Relay and WARP egress real users through them.
+var hostingKeywords = []string{
+	"hosting",
+	"datacenter",
+	"data center",
+	"server",
+	"vps",
+	"colocation",
+}
+
+// IsHosting reports whether the given ASN belongs to a known hosting or
+// cloud provider, falling back to keywords in the organization name.
+func IsHosting(asn uint, organization string) bool {
+	if hostingASNs[asn] {
+		return true
+	}
+
+	org := strings.ToLower(organization)
+	for _, kw := range hostingKeywords {
+		if strings.Contains(org, kw) {
+			return true
+		}
+	}
+	return false
+}
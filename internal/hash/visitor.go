@@ -6,23 +6,36 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// maxCachedSalts is the number of daily salts kept in memory: today's and,
+// for queued events, yesterday's.
+const maxCachedSalts = 2
+
 type Manager struct {
 	pool *pgxpool.Pool
+
+	mu    sync.Mutex
+	salts map[string]string
+
+	// importSalts caches the import salt of each domain, they never change.
+	importSalts sync.Map
 }
 
 func NewManager(pool *pgxpool.Pool) *Manager {
-	return &Manager{pool: pool}
+	return &Manager{pool: pool, salts: make(map[string]string)}
 }
 
-func (m *Manager) GetHash(ctx context.Context, domain, ip, userAgent string) (string, error) {
-	today := time.Now().UTC().Format("2006-01-02")
+// GetHash returns the anonymous visitor ID for a hit at the given time. The
+// salt rotates daily, so the same visitor gets a new ID every UTC day.
+func (m *Manager) GetHash(ctx context.Context, domain, ip, userAgent string, at time.Time) (string, error) {
+	day := at.UTC().Format("2006-01-02")
 
-	salt, err := m.getSalt(ctx, today)
+	salt, err := m.getSalt(ctx, day)
 	if err != nil {
 		return "", fmt.Errorf("get salt: %w", err)
 	}
@@ -32,28 +45,87 @@ func (m *Manager) GetHash(ctx context.Context, domain, ip, userAgent string) (st
 	return hex.EncodeToString(h[:]), nil
 }
 
-func (m *Manager) getSalt(ctx context.Context, date string) (string, error) {
+// ImportHash returns the visitor ID for a hit read from an access log. Daily
+// salts are pruned after two days, so past days use a salt kept per site
+// instead, mixed with the day. A second import of the same log gets the same
+// IDs without keeping salts for arbitrary past days, and the IDs never match
+// those of live hits.
+func (m *Manager) ImportHash(ctx context.Context, domain, ip, userAgent string, at time.Time) (string, error) {
+	day := at.UTC().Format("2006-01-02")
+
+	salt, err := m.getImportSalt(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("get import salt: %w", err)
+	}
+
+	raw := salt + ":" + day + ":" + domain + ":" + ip + ":" + userAgent
+	h := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(h[:]), nil
+}
+
+func (m *Manager) getImportSalt(ctx context.Context, domain string) (string, error) {
+	if salt, ok := m.importSalts.Load(domain); ok {
+		return salt.(string), nil
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("generate random salt: %w", err)
+	}
+
+	// The no-op update makes RETURNING give the existing salt on conflict.
 	var salt string
-	err := m.pool.QueryRow(ctx, "SELECT salt from daily_salts WHERE date = $1", date).Scan(&salt)
-	if err == nil {
+	err := m.pool.QueryRow(ctx,
+		`INSERT INTO import_salts (domain, salt) VALUES ($1, $2)
+		 ON CONFLICT (domain) DO UPDATE SET salt = import_salts.salt
+		 RETURNING salt`,
+		domain, hex.EncodeToString(bytes)).Scan(&salt)
+	if err != nil {
+		return "", err
+	}
+
+	m.importSalts.Store(domain, salt)
+	return salt, nil
+}
+
+// getSalt returns the salt of date, creating it on first use. Salts are
+// cached, so hits don't wait for a database connection once the day's salt
+// is known.
+func (m *Manager) getSalt(ctx context.Context, date string) (string, error) {
+	m.mu.Lock()
+	salt, ok := m.salts[date]
+	m.mu.Unlock()
+	if ok {
 		return salt, nil
 	}
 
-	// Generate new salt for today
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", fmt.Errorf("generate random salt: %w", err)
 	}
-	salt = hex.EncodeToString(bytes)
-
-	_, err = m.pool.Exec(ctx, 
-			`INSERT INTO daily_salts (date, salt) 
-			VALUES ($1, $2) ON CONFLICT (date) DO NOTHING`,
-			date, salt)
 
+	// The no-op update makes RETURNING give the salt another instance
+	// created first.
+	err := m.pool.QueryRow(ctx,
+		`INSERT INTO daily_salts (date, salt) VALUES ($1, $2)
+		 ON CONFLICT (date) DO UPDATE SET salt = daily_salts.salt
+		 RETURNING salt`,
+		date, hex.EncodeToString(bytes)).Scan(&salt)
 	if err != nil {
 		return "", fmt.Errorf("insert salt: %w", err)
-	}		
+	}
+
+	m.mu.Lock()
+	// Only the last days are ever asked for, drop the rest.
+	for d := range m.salts {
+		if d < date {
+			delete(m.salts, d)
+		}
+	}
+	if len(m.salts) < maxCachedSalts {
+		m.salts[date] = salt
+	}
+	m.mu.Unlock()
 
 	return salt, nil
 }
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"visitor/internal/bot"
+	"visitor/internal/client"
+	"visitor/internal/model"
+	"visitor/internal/referrer"
+	"visitor/internal/storage"
+
+	"github.com/mssola/useragent"
+)
+
+// combinedLogRe matches the Combined Log Format used by nginx and Apache:
+// host ident user [time] "request" status bytes "referer" "user-agent"
+var combinedLogRe = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) \S+ "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"`)
+
+const logTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// pageExtensions are the file extensions still counted as pages, every other
+// extension is an asset.
+var pageExtensions = map[string]bool{"": true, ".html": true, ".htm": true, ".php": true}
+
+// AccessLog imports page views from a Combined Log Format access log. Lines
+// go through the same exclusion rules and User-Agent, GeoIP and bot
+// processing as tracker events.
+// Visitor hashes come from hash.ImportHash, which gives a line the same hash
+// on every run, so the unique index keeps a second run of the same log from
+// counting twice.
+func (im *Importer) AccessLog(ctx context.Context, r io.Reader, domain string) (Result, error) {
+	domain, err := im.canonical(ctx, domain)
+	if err != nil {
+		return Result{}, err
+	}
+	site, err := im.db.GetSite(ctx, domain)
+	if err != nil {
+		return Result{}, err
+	}
+	rules, err := im.db.ListExclusionRules(ctx, domain)
+	if err != nil {
+		return Result{}, err
+	}
+	ex := model.CompileExclusions(rules)
+
+	res := Result{Domain: domain}
+	err = im.db.WithTx(ctx, func(tx *storage.DB) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+		for line := 1; scanner.Scan(); line++ {
+			pv, err := im.parseLine(ctx, scanner.Text(), site, ex)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if pv == nil {
+				res.Skipped++
+				continue
+			}
+
+			if err := tx.InsertPageView(ctx, pv); err != nil {
+				return fmt.Errorf("line %d: insert page view: %w", line, err)
+			}
+			res.Imported++
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// logEntry is a log line for a page request.
+type logEntry struct {
+	IP        string
+	Time      time.Time
+	Path      string
+	Query     url.Values
+	Referrer  string
+	UserAgent string
+}
+
+// parseLogLine reads a Combined Log Format line. It returns nil for lines that
+// aren't successful page requests, and an error only for a broken timestamp.
+func parseLogLine(line string) (*logEntry, error) {
+	m := combinedLogRe.FindStringSubmatch(line)
+	if m == nil {
+		return nil, nil
+	}
+	ip, rawTime, method, target, rawStatus, rawReferrer, userAgent := m[1], m[2], m[3], m[4], m[5], m[6], m[7]
+
+	status, _ := strconv.Atoi(rawStatus)
+	if method != http.MethodGet || !(status >= 200 && status < 300 || status == http.StatusNotModified) {
+		return nil, nil
+	}
+	if _, err := netip.ParseAddr(ip); err != nil {
+		return nil, nil
+	}
+
+	u, err := url.ParseRequestURI(target)
+	if err != nil || !pageExtensions[strings.ToLower(path.Ext(u.Path))] {
+		return nil, nil
+	}
+	pagePath := u.EscapedPath()
+	if len(pagePath) > 2048 {
+		return nil, nil
+	}
+
+	at, err := time.Parse(logTimeLayout, rawTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q", rawTime)
+	}
+
+	if rawReferrer == "-" {
+		rawReferrer = ""
+	}
+	if userAgent == "-" {
+		userAgent = ""
+	}
+
+	return &logEntry{
+		IP:        ip,
+		Time:      at,
+		Path:      pagePath,
+		Query:     u.Query(),
+		Referrer:  rawReferrer,
+		UserAgent: userAgent,
+	}, nil
+}
+
+// parseLine turns a log line into a page view, or nil when the line isn't one.
+func (im *Importer) parseLine(ctx context.Context, line string, site *model.Site, ex *model.Exclusions) (*model.PageView, error) {
+	e, err := parseLogLine(line)
+	if e == nil || err != nil {
+		return nil, err
+	}
+	if ex.MatchIP(e.IP) || ex.MatchPath(e.Path) {
+		return nil, nil
+	}
+
+	ua := useragent.New(e.UserAgent)
+	if bot.DetectUserAgent(ua) != "" {
+		return nil, nil
+	}
+
+	network := im.geoip.Network(e.IP)
+	if network.Hosting && site.DatacenterTraffic == model.DatacenterDrop {
+		return nil, nil
+	}
+
+	visitorHash, err := im.hasher.ImportHash(ctx, site.Domain, e.IP, e.UserAgent, e.Time)
+	if err != nil {
+		return nil, fmt.Errorf("get visitor hash: %w", err)
+	}
+
+	ref, _ := referrer.Parse(e.Referrer, site.Domain)
+	query := e.Query
+	utmSource, utmMedium := query.Get("utm_source"), query.Get("utm_medium")
+
+	info := client.Parse(ua, http.Header{"User-Agent": {e.UserAgent}})
+
+	return &model.PageView{
+		Domain:         site.Domain,
+		Hostname:       site.Domain,
+		Path:           e.Path,
+		Referrer:       ref.URL,
+		ReferrerHost:   ref.Host,
+		ReferrerSource: ref.Source,
+		Channel:        referrer.Channel(ref, utmSource, utmMedium),
+		UTMSource:      strings.TrimSpace(utmSource),
+		UTMMedium:      strings.TrimSpace(utmMedium),
+		UTMCampaign:    strings.TrimSpace(query.Get("utm_campaign")),
+		UTMTerm:        strings.TrimSpace(query.Get("utm_term")),
+		UTMContent:     strings.TrimSpace(query.Get("utm_content")),
+		CountryCode:    im.geoip.Country(e.IP),
+		Browser:        info.Browser,
+		BrowserVersion: info.BrowserVersion,
+		OS:             info.OS,
+		OSVersion:      info.OSVersion,
+		DeviceType:     info.DeviceType,
+		ASN:            int64(network.ASN),
+		ASNOrg:         network.Organization,
+		IsDatacenter:   network.Hosting,
+		VisitorHash:    visitorHash,
+		CreatedAt:      e.Time,
+	}, nil
+}
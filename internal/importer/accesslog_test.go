@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	at := time.Date(2024, time.March, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0"
+
+	tests := []struct {
+		name    string
+		line    string
+		want    *logEntry
+		wantErr bool
+	}{
+		{
+			name: "page view",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET /pricing?utm_source=news HTTP/1.1" 200 5120 "https://www.google.com/" "` + ua + `"`,
+			want: &logEntry{
+				IP:        "203.0.113.7",
+				Time:      at,
+				Path:      "/pricing",
+				Query:     url.Values{"utm_source": {"news"}},
+				Referrer:  "https://www.google.com/",
+				UserAgent: ua,
+			},
+		},
+		{
+			name: "ipv6, not modified and empty fields",
+			line: `2001:db8::1 - frank [10/Mar/2024:13:55:36 -0700] "GET /blog/post.html HTTP/2.0" 304 0 "-" "-"`,
+			want: &logEntry{IP: "2001:db8::1", Time: at, Path: "/blog/post.html", Query: url.Values{}},
+		},
+		{
+			name: "escaped quote in user agent",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET / HTTP/1.1" 200 1 "-" "Agent \"quoted\""`,
+			want: &logEntry{IP: "203.0.113.7", Time: at, Path: "/", Query: url.Values{}, UserAgent: `Agent \"quoted\"`},
+		},
+		{
+			name: "asset",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET /app.css HTTP/1.1" 200 512 "-" "-"`,
+		},
+		{
+			name: "post",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "POST /login HTTP/1.1" 200 512 "-" "-"`,
+		},
+		{
+			name: "not found",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET /missing HTTP/1.1" 404 512 "-" "-"`,
+		},
+		{
+			name: "redirect",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET /old HTTP/1.1" 301 0 "-" "-"`,
+		},
+		{
+			name: "host name instead of address",
+			line: `example.net - - [10/Mar/2024:13:55:36 -0700] "GET / HTTP/1.1" 200 512 "-" "-"`,
+		},
+		{
+			name: "common log format without referrer and user agent",
+			line: `203.0.113.7 - - [10/Mar/2024:13:55:36 -0700] "GET / HTTP/1.1" 200 512`,
+		},
+		{
+			name: "garbage",
+			line: `not a log line`,
+		},
+		{
+			name:    "broken time",
+			line:    `203.0.113.7 - - [10/March/2024 13:55 -0700] "GET / HTTP/1.1" 200 512 "-" "-"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil && tt.want != nil && !got.Time.Equal(tt.want.Time) {
+				t.Errorf("parseLogLine() time = %v, want %v", got.Time, tt.want.Time)
+			}
+			if got != nil && tt.want != nil {
+				got.Time = tt.want.Time
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLogLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
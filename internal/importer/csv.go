@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"visitor/internal/model"
+	"visitor/internal/storage"
+)
+
+// columns lists the header names a format uses for each field, compared
+// case-insensitively.
+type columns struct {
+	date, path, views, visitors []string
+}
+
+var csvColumns = map[string]columns{
+	// GA4 exploration and report exports, with Universal Analytics names as a
+	// fallback.
+	FormatGA: {
+		date:     []string{"date"},
+		path:     []string{"page path and screen class", "page path", "pagepath", "page"},
+		views:    []string{"views", "screenpageviews", "pageviews"},
+		visitors: []string{"total users", "totalusers", "users", "active users", "activeusers"},
+	},
+	// Plausible's imported_pages.csv and imported_visitors.csv.
+	FormatPlausible: {
+		date:     []string{"date"},
+		path:     []string{"page"},
+		views:    []string{"pageviews"},
+		visitors: []string{"visitors"},
+	},
+}
+
+var dateLayouts = []string{"2006-01-02", "20060102"}
+
+// CSV imports a daily export into imported_daily. Files with a page column
+// give per-page numbers, files without one the site totals per day.
+func (im *Importer) CSV(ctx context.Context, r io.Reader, domain, format string) (Result, error) {
+	domain, err := im.canonical(ctx, domain)
+	if err != nil {
+		return Result{}, err
+	}
+
+	days, err := parseCSV(r, domain, format)
+	if err != nil {
+		return Result{}, err
+	}
+
+	err = im.db.WithTx(ctx, func(tx *storage.DB) error {
+		for _, d := range days {
+			if err := tx.UpsertImportedDay(ctx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Domain: domain, Imported: len(days)}, nil
+}
+
+// parseCSV reads an export into one row per day and page, in file order.
+func parseCSV(r io.Reader, domain, format string) ([]*model.ImportedDay, error) {
+	cols, ok := csvColumns[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown csv format %q", format)
+	}
+
+	// Skip a byte order mark, or it hides GA's first comment line.
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	cr := csv.NewReader(br)
+	// GA prefixes its exports with "#" comment lines.
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	dateCol, viewsCol, visitorsCol := find(header, cols.date), find(header, cols.views), find(header, cols.visitors)
+	pathCol := find(header, cols.path)
+	if dateCol < 0 || viewsCol < 0 || visitorsCol < 0 {
+		return nil, errors.New("csv needs date, views and visitors columns")
+	}
+
+	// Sum rows first: GA splits a path by page title, and an upsert per row
+	// would keep only the last one.
+	type key struct {
+		date time.Time
+		path string
+	}
+	sums := make(map[key]*model.ImportedDay)
+	var days []*model.ImportedDay
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		if strings.TrimSpace(field(record, dateCol)) == "" {
+			continue // totals rows
+		}
+		date, err := parseDate(field(record, dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		views, err := parseCount(field(record, viewsCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: views: %w", line, err)
+		}
+		visitors, err := parseCount(field(record, visitorsCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: visitors: %w", line, err)
+		}
+
+		path := ""
+		if pathCol >= 0 {
+			path = strings.TrimSpace(field(record, pathCol))
+			if !strings.HasPrefix(path, "/") {
+				continue // app screens and "(not set)"
+			}
+		}
+
+		k := key{date, path}
+		d, ok := sums[k]
+		if !ok {
+			d = &model.ImportedDay{Domain: domain, Source: format, Date: date, Path: path}
+			sums[k] = d
+			days = append(days, d)
+		}
+		d.Views += views
+		d.Visitors += visitors
+	}
+
+	return days, nil
+}
+
+func find(header []string, names []string) int {
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		for _, name := range names {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseCount reads a number that may carry thousands separators.
+func parseCount(s string) (int64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
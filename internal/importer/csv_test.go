@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"visitor/internal/model"
+)
+
+func TestParseCSV(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []*model.ImportedDay
+		wantErr bool
+	}{
+		{
+			name:   "plausible pages",
+			format: FormatPlausible,
+			input: "date,page,pageviews,visitors\n" +
+				"2024-03-01,/,10,7\n" +
+				"2024-03-01,/pricing,3,2\n",
+			want: []*model.ImportedDay{
+				{Domain: "example.com", Source: FormatPlausible, Date: day(1), Path: "/", Views: 10, Visitors: 7},
+				{Domain: "example.com", Source: FormatPlausible, Date: day(1), Path: "/pricing", Views: 3, Visitors: 2},
+			},
+		},
+		{
+			name:   "plausible site totals",
+			format: FormatPlausible,
+			input:  "date,visitors,pageviews,bounces\n2024-03-02,5,9,1\n",
+			want: []*model.ImportedDay{
+				{Domain: "example.com", Source: FormatPlausible, Date: day(2), Views: 9, Visitors: 5},
+			},
+		},
+		{
+			name:   "ga export",
+			format: FormatGA,
+			input: "\ufeff# Pages and screens\n" +
+				"# Start date: 20240301\n" +
+				"Page path and screen class,Date,Views,Total users\n" +
+				"/,20240301,\"1,200\",800\n" +
+				"/,20240301,5,3\n" +
+				"(not set),20240301,4,4\n" +
+				",,\"1,209\",807\n",
+			want: []*model.ImportedDay{
+				{Domain: "example.com", Source: FormatGA, Date: day(1), Path: "/", Views: 1205, Visitors: 803},
+			},
+		},
+		{
+			name:    "missing column",
+			format:  FormatGA,
+			input:   "Date,Views\n20240301,5\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad date",
+			format:  FormatPlausible,
+			input:   "date,pageviews,visitors\n03/01/2024,1,1\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad count",
+			format:  FormatPlausible,
+			input:   "date,pageviews,visitors\n2024-03-01,many,1\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			format:  "matomo",
+			input:   "date,pageviews,visitors\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV(strings.NewReader(tt.input), "example.com", tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCSV() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package importer loads historical data from other analytics tools and web
+// server access logs. Imports are idempotent: CSV rollups replace the rows of
+// an earlier run and log lines hit the page_views unique index.
+package importer
+
+import (
+	"context"
+	"strings"
+	"visitor/internal/geoip"
+	"visitor/internal/hash"
+	"visitor/internal/model"
+	"visitor/internal/storage"
+)
+
+// Input formats accepted by the import command.
+const (
+	FormatGA        = "ga"
+	FormatPlausible = "plausible"
+	FormatLog       = "log"
+)
+
+type Importer struct {
+	db     *storage.DB
+	hasher *hash.Manager
+	geoip  *geoip.Resolver
+}
+
+func New(db *storage.DB, hasher *hash.Manager, geoip *geoip.Resolver) *Importer {
+	return &Importer{db: db, hasher: hasher, geoip: geoip}
+}
+
+// Result counts what an import did with its input.
+type Result struct {
+	// Domain is the site the rows were recorded under, see canonical.
+	Domain string
+	// Imported is the number of rollup rows or page views written. Page views
+	// already present from an earlier run are counted but not stored twice.
+	Imported int
+	// Skipped counts log lines that aren't page views, such as assets, errors
+	// and bots, and those the site's exclusion rules drop.
+	Skipped int
+}
+
+// canonical resolves domain to the site live ingestion records its events
+// under, so importing www.example.com or an alias fills the site's data.
+func (im *Importer) canonical(ctx context.Context, domain string) (string, error) {
+	sites, err := im.db.ListSites(ctx)
+	if err != nil {
+		return "", err
+	}
+	return model.NewSiteIndex(sites).Resolve(model.NormalizeHost(strings.TrimSpace(domain))), nil
+}
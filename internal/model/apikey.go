@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// APIKey authorizes server-to-server ingestion for one domain. Only a hash of
+// the key is stored, Key is set just once in the response that creates it.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Domain     string     `json:"domain"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
@@ -2,22 +2,109 @@ package model
 
 import "time"
 
+// Event types accepted by the ingestion endpoint. An empty type is a page view.
+const (
+	EventPageView = "pageview"
+	EventOutbound = "outbound"
+	EventDownload = "download"
+	// EventEngagement summarizes scroll depth and visible time of a page view.
+	EventEngagement = "engagement"
+	// EventOptOut is sent once when a visitor opts out of tracking.
+	EventOptOut = "opt_out"
+)
+
 type EventRequest struct {
+	Type		string		`json:"type"`
 	Domain 		string		`json:"domain"`
+	// Hostname is the host the event happened on, with its port. It
+	// defaults to Domain, which names the site.
+	Hostname	string		`json:"hostname"`
 	Path 		string 		`json:"path"`
 	Referrer	string		`json:"referrer"`
 	ScreenSize 	string		`json:"screen_size"`
+	UTMSource	string		`json:"utm_source"`
+	UTMMedium	string		`json:"utm_medium"`
+	UTMCampaign	string		`json:"utm_campaign"`
+	UTMTerm		string		`json:"utm_term"`
+	UTMContent	string		`json:"utm_content"`
+	URL			string		`json:"url"`
+	ScrollDepth	int			`json:"scroll_depth"`
+	EngagementMs int64		`json:"engagement_ms"`
+}
+
+// ServerEvent is an event submitted through the server-to-server API. It
+// names the client explicitly instead of taking it from the HTTP request.
+type ServerEvent struct {
+	EventRequest
+	IP			string				`json:"ip"`
+	UserAgent	string				`json:"user_agent"`
+	// Headers optionally carries further client request headers such as
+	// Accept-Language, Sec-CH-UA, DNT or Sec-GPC.
+	Headers		map[string]string	`json:"headers"`
+	// Timestamp defaults to the time the event is received.
+	Timestamp	*time.Time			`json:"timestamp"`
+}
+
+type IngestRequest struct {
+	Events		[]ServerEvent		`json:"events"`
+}
+
+// BatchEvent is an event the tracker queued while it couldn't reach the
+// server, stamped with the time it actually happened.
+type BatchEvent struct {
+	EventRequest
+	Timestamp	time.Time			`json:"timestamp"`
+}
+
+type BatchRequest struct {
+	Events		[]BatchEvent		`json:"events"`
+}
+
+type IngestResponse struct {
+	Accepted	int			`json:"accepted"`
+	Filtered	int			`json:"filtered"`
+	// Rejected lists the indexes of batch events that were invalid and
+	// skipped.
+	Rejected	[]int		`json:"rejected,omitempty"`
 }
 
 type PageView struct {
 	ID			int64
 	Domain		string
+	// Hostname is the host the view happened on, Domain the site it is
+	// recorded under.
+	Hostname	string
 	Path    	string
 	Referrer 	string
+	ReferrerHost string
+	ReferrerSource string
+	Channel string
 	CountryCode string
 	ScreenSize string
+	UTMSource string
+	UTMMedium string
+	UTMCampaign string
+	UTMTerm string
+	UTMContent string
 	Browser string
+	BrowserVersion string
 	OS string
+	OSVersion string
+	DeviceType string
+	ASN int64
+	ASNOrg string
+	IsDatacenter bool
 	VisitorHash string
 	CreatedAt   time.Time
-}
\ No newline at end of file
+}
+
+// LinkEvent is a click on an outbound link or a file download.
+type LinkEvent struct {
+	ID			int64
+	Domain		string
+	Type		string
+	URL			string
+	Path		string
+	VisitorHash	string
+	CreatedAt	time.Time
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// Exclusion rule kinds.
+const (
+	ExcludeIP   = "ip"
+	ExcludePath = "path"
+)
+
+// ExclusionRule drops matching events before they are stored. IP rules hold
+// an address or CIDR range, path rules a glob where * matches any characters.
+type ExclusionRule struct {
+	ID     int64  `json:"id"`
+	Domain string `json:"domain"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+}
+
+// Exclusions is the compiled form of a site's exclusion rules.
+type Exclusions struct {
+	prefixes []netip.Prefix
+	paths    []*regexp.Regexp
+}
+
+// CompileExclusions compiles rules, skipping invalid ones.
+func CompileExclusions(rules []ExclusionRule) *Exclusions {
+	ex := &Exclusions{}
+	for _, rule := range rules {
+		switch rule.Kind {
+		case ExcludeIP:
+			if prefix, err := ParseIPRule(rule.Value); err == nil {
+				ex.prefixes = append(ex.prefixes, prefix)
+			}
+		case ExcludePath:
+			if re, err := CompilePathRule(rule.Value); err == nil {
+				ex.paths = append(ex.paths, re)
+			}
+		}
+	}
+	return ex
+}
+
+func (ex *Exclusions) MatchIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range ex.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ex *Exclusions) MatchPath(path string) bool {
+	for _, re := range ex.paths {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIPRule accepts a CIDR range or a single address.
+func ParseIPRule(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// CompilePathRule turns a path pattern such as /admin/* into a regexp where
+// * matches any run of characters, including slashes.
+func CompilePathRule(pattern string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path pattern must start with /")
+	}
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.Compile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
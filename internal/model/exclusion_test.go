@@ -0,0 +1,104 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestCompilePathRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/admin", "/admin", true},
+		{"/admin", "/admin/", false},
+		{"/admin/*", "/admin/", true},
+		{"/admin/*", "/admin/users/1", true},
+		{"/admin/*", "/administrator", false},
+		{"/*.php", "/wp/login.php", true},
+		{"/*.php", "/index.phps", false},
+		{"/blog/*/edit", "/blog/2024/post/edit", true},
+		{"/blog/*/edit", "/blog/post", false},
+		{"/a+b(c)", "/a+b(c)", true},
+		{"/a+b(c)", "/aab", false},
+		{"/*", "/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			re, err := CompilePathRule(tt.pattern)
+			if err != nil {
+				t.Fatalf("CompilePathRule(%q) error = %v", tt.pattern, err)
+			}
+			if got := re.MatchString(tt.path); got != tt.want {
+				t.Errorf("CompilePathRule(%q) matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	for _, pattern := range []string{"", "admin/*", "*"} {
+		if _, err := CompilePathRule(pattern); err == nil {
+			t.Errorf("CompilePathRule(%q) accepted a pattern without a leading /", pattern)
+		}
+	}
+}
+
+func TestParseIPRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "203.0.113.7", want: "203.0.113.7/32"},
+		{value: "203.0.113.0/24", want: "203.0.113.0/24"},
+		{value: "203.0.113.7/24", want: "203.0.113.0/24"},
+		{value: "2001:db8::1", want: "2001:db8::1/128"},
+		{value: "2001:db8::1/32", want: "2001:db8::/32"},
+		{value: "203.0.113.0/33", wantErr: true},
+		{value: "example.com", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseIPRule(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPRule(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseIPRule(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionsMatch(t *testing.T) {
+	ex := CompileExclusions([]ExclusionRule{
+		{Kind: ExcludeIP, Value: "203.0.113.0/24"},
+		{Kind: ExcludeIP, Value: "2001:db8::1"},
+		{Kind: ExcludeIP, Value: "not an address"},
+		{Kind: ExcludePath, Value: "/admin/*"},
+		{Kind: ExcludePath, Value: "no slash"},
+	})
+
+	ips := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.200", true},
+		{"::ffff:203.0.113.5", true},
+		{"203.0.114.1", false},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"garbage", false},
+	}
+	for _, tt := range ips {
+		if got := ex.MatchIP(tt.ip); got != tt.want {
+			t.Errorf("MatchIP(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if !ex.MatchPath("/admin/settings") || ex.MatchPath("/about") {
+		t.Error("MatchPath doesn't follow the /admin/* rule")
+	}
+}
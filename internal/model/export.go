@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// RawEvent is a page view as exported by /api/export/events.
+type RawEvent struct {
+	ID             int64     `json:"id" parquet:"id"`
+	Domain         string    `json:"domain" parquet:"domain"`
+	Hostname       string    `json:"hostname" parquet:"hostname"`
+	Path           string    `json:"path" parquet:"path"`
+	Referrer       string    `json:"referrer" parquet:"referrer"`
+	ReferrerHost   string    `json:"referrer_host" parquet:"referrer_host"`
+	ReferrerSource string    `json:"referrer_source" parquet:"referrer_source"`
+	Channel        string    `json:"channel" parquet:"channel"`
+	CountryCode    string    `json:"country_code" parquet:"country_code"`
+	ScreenSize     string    `json:"screen_size" parquet:"screen_size"`
+	UTMSource      string    `json:"utm_source" parquet:"utm_source"`
+	UTMMedium      string    `json:"utm_medium" parquet:"utm_medium"`
+	UTMCampaign    string    `json:"utm_campaign" parquet:"utm_campaign"`
+	UTMTerm        string    `json:"utm_term" parquet:"utm_term"`
+	UTMContent     string    `json:"utm_content" parquet:"utm_content"`
+	Browser        string    `json:"browser" parquet:"browser"`
+	BrowserVersion string    `json:"browser_version" parquet:"browser_version"`
+	OS             string    `json:"os" parquet:"os"`
+	OSVersion      string    `json:"os_version" parquet:"os_version"`
+	DeviceType     string    `json:"device_type" parquet:"device_type"`
+	ASN            int64     `json:"asn" parquet:"asn"`
+	ASNOrg         string    `json:"asn_org" parquet:"asn_org"`
+	IsDatacenter   bool      `json:"is_datacenter" parquet:"is_datacenter"`
+	ScrollDepth    *int32    `json:"scroll_depth" parquet:"scroll_depth,optional"`
+	EngagementMs   *int64    `json:"engagement_ms" parquet:"engagement_ms,optional"`
+	CreatedAt      time.Time `json:"created_at" parquet:"created_at,timestamp(millisecond)"`
+}
+
+// RawEventWithHash adds the visitor hash, which exports leave out on request.
+type RawEventWithHash struct {
+	RawEvent
+	VisitorHash string `json:"visitor_hash" parquet:"visitor_hash"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ImportedDay is a daily rollup imported from another analytics tool. Rows
+// with an empty Path hold the site-wide totals of the day.
+type ImportedDay struct {
+	Domain   string
+	Source   string
+	Date     time.Time
+	Path     string
+	Views    int64
+	Visitors int64
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Datacenter traffic handling modes for a site.
+const (
+	DatacenterTag  = "tag"
+	DatacenterDrop = "drop"
+)
+
+// Site holds per-domain settings. Domains without a row use DefaultSite.
+type Site struct {
+	Domain            string `json:"domain"`
+	DatacenterTraffic string `json:"datacenter_traffic"`
+	// HonorDNT and HonorGPC drop events from browsers sending DNT: 1 or
+	// Sec-GPC: 1.
+	HonorDNT bool `json:"honor_dnt"`
+	HonorGPC bool `json:"honor_gpc"`
+	// Timezone is the IANA name reports use for days and periods.
+	Timezone string `json:"timezone"`
+	// Aliases are further hostnames, or "*.example.com" for every
+	// subdomain, whose events are recorded under this site.
+	Aliases []string `json:"aliases"`
+}
+
+func DefaultSite(domain string) *Site {
+	return &Site{
+		Domain:            domain,
+		DatacenterTraffic: DatacenterTag,
+		Timezone:          "UTC",
+		Aliases:           []string{},
+	}
+}
+
+var hostnameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// NormalizeHost lowercases a hostname and drops a trailing dot.
+func NormalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// ValidDomainPattern accepts a hostname or "*." followed by a domain of at
+// least two labels, e.g. "*.example.com".
+func ValidDomainPattern(pattern string) bool {
+	host, wildcard := strings.CutPrefix(pattern, "*.")
+	if wildcard && !strings.Contains(host, ".") {
+		return false
+	}
+	return len(host) <= 253 && hostnameRe.MatchString(host)
+}
+
+// MatchDomain reports whether host is pattern or, for a "*.example.com"
+// pattern, one of its subdomains.
+func MatchDomain(pattern, host string) bool {
+	if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+parent)
+	}
+	return host == pattern
+}
+
+// ValidTimezone accepts IANA names such as "Europe/Berlin". "Local" is
+// rejected, the database doesn't know the server's zone.
+func ValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// SiteIndex maps hostnames to the site their events are recorded under.
+type SiteIndex struct {
+	// sites are the configured site domains.
+	sites map[string]bool
+	// aliases maps alias hostnames and "*.example.com" patterns to their
+	// site.
+	aliases map[string]string
+}
+
+func NewSiteIndex(sites []Site) *SiteIndex {
+	idx := &SiteIndex{
+		sites:   make(map[string]bool, len(sites)),
+		aliases: make(map[string]string),
+	}
+	for _, site := range sites {
+		idx.sites[site.Domain] = true
+		for _, alias := range site.Aliases {
+			idx.aliases[alias] = site.Domain
+		}
+	}
+	return idx
+}
+
+// Resolve returns the site host belongs to: a configured site, the site
+// listing it as an alias or the most specific matching wildcard. Otherwise
+// a leading "www." is dropped when that leads to a configured site, so
+// www.example.com counts as example.com. Other hosts stay as they are, the
+// data of a site tracked as www.example.com stays under that name.
+func (idx *SiteIndex) Resolve(host string) string {
+	if idx.sites[host] {
+		return host
+	}
+	if site, ok := idx.aliases[host]; ok {
+		return site
+	}
+	for parent := host; ; {
+		var ok bool
+		if _, parent, ok = strings.Cut(parent, "."); !ok {
+			break
+		}
+		if site, ok := idx.aliases["*."+parent]; ok {
+			return site
+		}
+	}
+	if bare, ok := strings.CutPrefix(host, "www."); ok && bare != "" {
+		if site := idx.Resolve(bare); idx.sites[site] {
+			return site
+		}
+	}
+	return host
+}
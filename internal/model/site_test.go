@@ -0,0 +1,40 @@
+package model
+
+import "testing"
+
+func TestSiteIndexResolve(t *testing.T) {
+	idx := NewSiteIndex([]Site{
+		{Domain: "example.com", Aliases: []string{"example.net", "*.example.com"}},
+		{Domain: "blog.example.com", Aliases: []string{"*.preview.example.com"}},
+		{Domain: "www.other.org"},
+	})
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"blog.example.com", "blog.example.com"},
+		{"example.net", "example.com"},
+		{"www.example.net", "example.com"},
+		{"app.example.com", "example.com"},
+		{"a.b.example.com", "example.com"},
+		{"pr-1.preview.example.com", "blog.example.com"},
+		{"www.example.com", "example.com"},
+		{"www.other.org", "www.other.org"},
+		{"other.org", "other.org"},
+		{"www.www.example.com", "example.com"},
+		{"www.unknown.io", "www.unknown.io"},
+		{"www.www.unknown.io", "www.www.unknown.io"},
+		{"unknown.io", "unknown.io"},
+		{"www.", "www."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := idx.Resolve(tt.host); got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
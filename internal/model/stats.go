@@ -3,19 +3,89 @@ package model
 type SummaryStats struct {
 	TotalViews		int		  		`json:"total_views"`
 	UniqueVisitors	int				`json:"unique_visitors"`
-	ViewsPerDay		[]DailyStat		`json:"views_per_day"`
+	// VisitorsPerDomain is set for combined sites, whose unique visitors are
+	// the sum of those of each domain: visitor hashes are salted with the
+	// domain, so the same person counts once per domain.
+	VisitorsPerDomain	bool		`json:"visitors_per_domain,omitempty"`
+	Interval		string			`json:"interval"`
+	Series			[]TimeStat		`json:"series"`
 }
 
-type DailyStat struct {
-	Date		string		`json:"date"`
+// TimeStat is one bucket of a time series. Start is the local time the bucket
+// begins, "2006-01-02" or "2006-01-02T15:04" for hourly buckets.
+type TimeStat struct {
+	Start		string		`json:"start"`
 	Views		int			`json:"views"`
 	Visitors	int			`json:"visitors"`
 }
 
+// TimeSeries holds a time series per value of a dimension, e.g. the views of
+// a few pages.
+type TimeSeries struct {
+	Dimension	string			`json:"dimension"`
+	Interval	string			`json:"interval"`
+	Values		[]ValueSeries	`json:"values"`
+}
+
+type ValueSeries struct {
+	Value		string			`json:"value"`
+	Series		[]TimeStat		`json:"series"`
+}
+
+// ValueStat is a bucket of one value's series, as a flat row for CSV.
+type ValueStat struct {
+	Value		string		`json:"value"`
+	Start		string		`json:"start"`
+	Views		int			`json:"views"`
+	Visitors	int			`json:"visitors"`
+}
+
+// Items returns the series as flat rows.
+func (t *TimeSeries) Items() any {
+	rows := []ValueStat{}
+	for _, v := range t.Values {
+		for _, b := range v.Series {
+			rows = append(rows, ValueStat{Value: v.Value, Start: b.Start, Views: b.Views, Visitors: b.Visitors})
+		}
+	}
+	return rows
+}
+
+// Overview compares the tracked sites over a period.
+type Overview struct {
+	Interval	string			`json:"interval"`
+	Sites		[]SiteOverview	`json:"sites"`
+}
+
+// SiteStats are the totals of one site. PreviousViews are the views of the
+// period before, to show the trend.
+type SiteStats struct {
+	Domain			string		`json:"domain"`
+	Views			int			`json:"views"`
+	Visitors		int			`json:"visitors"`
+	PreviousViews	int			`json:"previous_views"`
+}
+
+type SiteOverview struct {
+	SiteStats
+	Series		[]TimeStat		`json:"series"`
+}
+
+// Items returns the totals of each site, without their series.
+func (o *Overview) Items() any {
+	rows := []SiteStats{}
+	for _, s := range o.Sites {
+		rows = append(rows, s.SiteStats)
+	}
+	return rows
+}
+
 type PageStats struct {
 	Path		string		`json:"path"`
 	Views		int			`json:"views"`
 	Visitors	int			`json:"visitors"`
+	AvgScrollDepth	int		`json:"avg_scroll_depth"`
+	AvgTimeOnPage	int		`json:"avg_time_on_page"`
 }
 
 type ReferrerStats struct {
@@ -29,3 +99,21 @@ type DimensionStats struct {
 	Views		int			`json:"views"`
 	Visitors	int			`json:"visitors"`
 }
+
+type FilteredStat struct {
+	Date		string		`json:"date"`
+	Reason		string		`json:"reason"`
+	Hits		int			`json:"hits"`
+}
+
+// Breakdown is one page of a report's rows along with the number of rows on
+// all pages.
+type Breakdown[T any] struct {
+	Rows		[]T			`json:"rows"`
+	Total		int			`json:"total"`
+}
+
+// Items returns the rows of the page.
+func (b *Breakdown[T]) Items() any {
+	return b.Rows
+}
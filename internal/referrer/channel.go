@@ -0,0 +1,79 @@
+package referrer
+
+import "strings"
+
+// Traffic channels stored in page_views.channel.
+const (
+	ChannelDirect   = "Direct"
+	ChannelSearch   = "Organic Search"
+	ChannelSocial   = "Social"
+	ChannelReferral = "Referral"
+	ChannelEmail    = "Email"
+	ChannelPaid     = "Paid"
+)
+
+var paidMediums = map[string]bool{
+	"cpc":         true,
+	"ppc":         true,
+	"cpm":         true,
+	"cpv":         true,
+	"paid":        true,
+	"paidsearch":  true,
+	"paid_search": true,
+	"paid-search": true,
+	"paid_social": true,
+	"paid-social": true,
+	"paidsocial":  true,
+	"display":     true,
+	"banner":      true,
+	"retargeting": true,
+	"affiliate":   true,
+}
+
+var emailMediums = map[string]bool{
+	"email":      true,
+	"e-mail":     true,
+	"e_mail":     true,
+	"mail":       true,
+	"newsletter": true,
+}
+
+var socialMediums = map[string]bool{
+	"social":         true,
+	"social-network": true,
+	"social_network": true,
+	"social-media":   true,
+	"social_media":   true,
+	"sm":             true,
+}
+
+// Channel classifies a visit from its parsed referrer and UTM parameters.
+// An explicit utm_medium wins over what the referrer suggests, so a paid
+// Google ad is Paid rather than Organic Search.
+func Channel(ref Referrer, utmSource, utmMedium string) string {
+	medium := strings.ToLower(strings.TrimSpace(utmMedium))
+	switch {
+	case paidMediums[medium]:
+		return ChannelPaid
+	case emailMediums[medium]:
+		return ChannelEmail
+	case socialMediums[medium]:
+		return ChannelSocial
+	case medium == "organic":
+		return ChannelSearch
+	}
+
+	switch ref.Category {
+	case "search":
+		return ChannelSearch
+	case "social":
+		return ChannelSocial
+	case "email":
+		return ChannelEmail
+	}
+
+	if ref.Host != "" || utmSource != "" || medium != "" {
+		return ChannelReferral
+	}
+	return ChannelDirect
+}
@@ -0,0 +1,41 @@
+package referrer
+
+import "testing"
+
+func TestChannel(t *testing.T) {
+	parse := func(raw string) Referrer {
+		ref, _ := Parse(raw, "example.com")
+		return ref
+	}
+
+	tests := []struct {
+		name      string
+		ref       Referrer
+		utmSource string
+		utmMedium string
+		want      string
+	}{
+		{name: "direct", want: ChannelDirect},
+		{name: "search", ref: parse("https://www.google.com/"), want: ChannelSearch},
+		{name: "social", ref: parse("https://news.ycombinator.com/item?id=1"), want: ChannelSocial},
+		{name: "email client", ref: parse("https://mail.google.com/"), want: ChannelEmail},
+		{name: "other known source", ref: parse("https://en.wikipedia.org/wiki/Go"), want: ChannelReferral},
+		{name: "unknown site", ref: parse("https://blog.other.org/"), want: ChannelReferral},
+		{name: "self-referral", ref: parse("https://www.example.com/about"), want: ChannelDirect},
+		{name: "utm source only", utmSource: "newsletter-42", want: ChannelReferral},
+		{name: "unknown medium", utmMedium: "qr", want: ChannelReferral},
+		{name: "paid medium wins over search", ref: parse("https://www.google.com/"), utmMedium: "cpc", want: ChannelPaid},
+		{name: "medium is trimmed and case-insensitive", utmMedium: " PPC ", want: ChannelPaid},
+		{name: "email medium", utmMedium: "newsletter", want: ChannelEmail},
+		{name: "social medium wins over referral", ref: parse("https://blog.other.org/"), utmMedium: "social", want: ChannelSocial},
+		{name: "organic medium", utmMedium: "organic", want: ChannelSearch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Channel(tt.ref, tt.utmSource, tt.utmMedium); got != tt.want {
+				t.Errorf("Channel(%+v, %q, %q) = %q, want %q", tt.ref, tt.utmSource, tt.utmMedium, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package referrer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Referrer is a parsed and normalized document.referrer.
+type Referrer struct {
+	// URL is the referrer without query string and fragment.
+	URL string
+	// Host is the lowercased hostname, see NormalizeHost.
+	Host string
+	// Source is a friendly name such as "Google", or Host when unknown.
+	Source string
+	// Category is the group Source belongs to in sources.json, e.g. "search".
+	Category string
+}
+
+type known struct {
+	source   string
+	category string
+}
+
+//go:embed sources.json
+var sourcesFile []byte
+
+// hosts maps every host in sources.json to its source.
+var hosts = loadSources(sourcesFile)
+
+func loadSources(data []byte) map[string]known {
+	var categories map[string]map[string][]string
+	if err := json.Unmarshal(data, &categories); err != nil {
+		panic("referrer: invalid sources.json: " + err.Error())
+	}
+
+	out := make(map[string]known)
+	for category, sources := range categories {
+		for source, domains := range sources {
+			for _, d := range domains {
+				out[d] = known{source: source, category: category}
+			}
+		}
+	}
+	return out
+}
+
+// Parse normalizes raw and resolves its source. It returns false when raw is
+// empty, unparsable or a self-referral from siteDomain or its subdomains.
+func Parse(raw string, siteDomain string) (Referrer, bool) {
+	if raw == "" {
+		return Referrer{}, false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return Referrer{}, false
+	}
+
+	host := NormalizeHost(u.Hostname())
+	site := NormalizeHost(siteDomain)
+	if host == site || strings.HasSuffix(host, "."+site) {
+		return Referrer{}, false
+	}
+
+	ref := Referrer{
+		URL:    u.Scheme + "://" + u.Host + u.EscapedPath(),
+		Host:   host,
+		Source: host,
+	}
+	if k, ok := lookup(host); ok {
+		ref.Source = k.source
+		ref.Category = k.category
+	}
+
+	return ref, true
+}
+
+// NormalizeHost lowercases host and strips "www." and "m." prefixes, as
+// long as a domain of at least two labels remains: m.com stays m.com.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, prefix := range []string{"www.", "m."} {
+		if rest, ok := strings.CutPrefix(host, prefix); ok && strings.Contains(rest, ".") {
+			host = rest
+		}
+	}
+	return host
+}
+
+// lookup matches host against the known sources, walking up to parent
+// domains so that e.g. "en.wikipedia.org" resolves to Wikipedia.
+func lookup(host string) (known, bool) {
+	for {
+		if k, ok := hosts[host]; ok {
+			return k, true
+		}
+		i := strings.IndexByte(host, '.')
+		if i == -1 || !strings.Contains(host[i+1:], ".") {
+			return known{}, false
+		}
+		host = host[i+1:]
+	}
+}
@@ -0,0 +1,114 @@
+package referrer
+
+import "testing"
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"www.example.com", "example.com"},
+		{"m.example.com", "example.com"},
+		{"www.m.example.com", "example.com"},
+		{"m.www.example.com", "www.example.com"},
+		{"blog.example.com", "blog.example.com"},
+		{"m.com", "m.com"},
+		{"www.com", "www.com"},
+		{"www.m.com", "m.com"},
+		{"mm.example.com", "mm.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := NormalizeHost(tt.host); got != tt.want {
+				t.Errorf("NormalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		site   string
+		want   Referrer
+		wantOK bool
+	}{
+		{
+			name:   "known search engine",
+			raw:    "https://www.google.com/search?q=visitor#top",
+			site:   "example.com",
+			want:   Referrer{URL: "https://www.google.com/search", Host: "google.com", Source: "Google", Category: "search"},
+			wantOK: true,
+		},
+		{
+			name:   "known subdomain through its parent",
+			raw:    "https://en.m.wikipedia.org/wiki/Go",
+			site:   "example.com",
+			want:   Referrer{URL: "https://en.m.wikipedia.org/wiki/Go", Host: "en.m.wikipedia.org", Source: "Wikipedia", Category: "other"},
+			wantOK: true,
+		},
+		{
+			name:   "mobile social site",
+			raw:    "https://m.facebook.com/",
+			site:   "example.com",
+			want:   Referrer{URL: "https://m.facebook.com/", Host: "facebook.com", Source: "Facebook", Category: "social"},
+			wantOK: true,
+		},
+		{
+			name:   "email client",
+			raw:    "https://mail.google.com/mail/u/0/",
+			site:   "example.com",
+			want:   Referrer{URL: "https://mail.google.com/mail/u/0/", Host: "mail.google.com", Source: "Gmail", Category: "email"},
+			wantOK: true,
+		},
+		{
+			name:   "unknown host",
+			raw:    "https://blog.other.org/post?id=1",
+			site:   "example.com",
+			want:   Referrer{URL: "https://blog.other.org/post", Host: "blog.other.org", Source: "blog.other.org"},
+			wantOK: true,
+		},
+		{
+			name:   "two-label m. host",
+			raw:    "https://m.com/x",
+			site:   "example.com",
+			want:   Referrer{URL: "https://m.com/x", Host: "m.com", Source: "m.com"},
+			wantOK: true,
+		},
+		{
+			name:   "host with port",
+			raw:    "http://localhost:3000/page",
+			site:   "example.com",
+			want:   Referrer{URL: "http://localhost:3000/page", Host: "localhost", Source: "localhost"},
+			wantOK: true,
+		},
+		{name: "self-referral", raw: "https://example.com/about", site: "example.com"},
+		{name: "self-referral from www", raw: "https://www.example.com/", site: "example.com"},
+		{name: "self-referral to a www site", raw: "https://example.com/", site: "www.example.com"},
+		{name: "self-referral from a subdomain", raw: "https://blog.example.com/post", site: "example.com"},
+		{name: "self-referral from a nested subdomain", raw: "https://a.b.example.com/", site: "Example.com"},
+		{
+			name:   "lookalike of the site",
+			raw:    "https://notexample.com/",
+			site:   "example.com",
+			want:   Referrer{URL: "https://notexample.com/", Host: "notexample.com", Source: "notexample.com"},
+			wantOK: true,
+		},
+		{name: "empty", raw: "", site: "example.com"},
+		{name: "no host", raw: "/relative/path", site: "example.com"},
+		{name: "unparsable", raw: "http://[::1", site: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse(tt.raw, tt.site)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Parse(%q, %q) = %+v, %v, want %+v, %v", tt.raw, tt.site, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"visitor/internal/logging"
+	"visitor/internal/model"
+)
+
+// ignoreCookie marks a browser whose visits are never recorded. It is set
+// from the dashboard on this server's origin and comes along with tracker
+// requests as long as the browser allows third-party cookies.
+const ignoreCookie = "visitor_ignore"
+
+func (s *Server) handleListExclusions(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.db.ListExclusionRules(r.Context(), r.PathValue("domain"))
+	if err != nil {
+		logging.InternalError(w, r, "Failed to list exclusion rules", err)
+		return
+	}
+
+	writeJSON(w, rules)
+}
+
+func (s *Server) handleCreateExclusion(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<10) // 10KB
+
+	var rule model.ExclusionRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	rule.Domain = r.PathValue("domain")
+	rule.Value = strings.TrimSpace(rule.Value)
+
+	switch rule.Kind {
+	case model.ExcludeIP:
+		if _, err := model.ParseIPRule(rule.Value); err != nil {
+			http.Error(w, "value must be an IP address or CIDR range", http.StatusBadRequest)
+			return
+		}
+	case model.ExcludePath:
+		if _, err := model.CompilePathRule(rule.Value); err != nil || len(rule.Value) > 2048 {
+			http.Error(w, "value must be a path pattern starting with /", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "kind must be ip or path", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.InsertExclusionRule(r.Context(), &rule); err != nil {
+		logging.InternalError(w, r, "Failed to create exclusion rule", err)
+		return
+	}
+	s.sites.invalidate(rule.Domain)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (s *Server) handleDeleteExclusion(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.db.DeleteExclusionRule(r.Context(), domain, id)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to delete exclusion rule", err)
+		return
+	}
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	s.sites.invalidate(domain)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetIgnore(w http.ResponseWriter, r *http.Request) {
+	_, err := r.Cookie(ignoreCookie)
+	writeJSON(w, map[string]bool{"ignored": err == nil})
+}
+
+// handleSetIgnore sets or clears the "block my browser" cookie. SameSite=None
+// is required for the cookie to reach the ingestion endpoint from the sites.
+func (s *Server) handleSetIgnore(w http.ResponseWriter, r *http.Request) {
+	cookie := &http.Cookie{
+		Name:     ignoreCookie,
+		Value:    "1",
+		Path:     "/api/",
+		MaxAge:   int((5 * 365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	}
+	if r.Method == http.MethodDelete {
+		cookie.Value = ""
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(w, cookie)
+	writeJSON(w, map[string]bool{"ignored": r.Method != http.MethodDelete})
+}
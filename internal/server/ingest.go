@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+	"visitor/internal/logging"
+	"visitor/internal/model"
+	"visitor/internal/storage"
+)
+
+const (
+	// maxEventAge bounds how far back a client timestamp may go.
+	maxEventAge = 24 * time.Hour
+	// maxClockSkew tolerates client clocks running slightly ahead.
+	maxClockSkew = time.Minute
+	// maxIngestEvents caps the number of events in a single request.
+	maxIngestEvents = 1000
+	// maxBatchEvents caps the events a tracker may flush at once.
+	maxBatchEvents = 100
+)
+
+type apiKeyDomainKey struct{}
+
+// eventTime resolves an optional client timestamp, rejecting anything older
+// than maxEventAge or in the future.
+func eventTime(ts *time.Time, now time.Time) (time.Time, bool) {
+	if ts == nil || ts.IsZero() {
+		return now, true
+	}
+	if ts.Before(now.Add(-maxEventAge)) || ts.After(now.Add(maxClockSkew)) {
+		return time.Time{}, false
+	}
+	return *ts, true
+}
+
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// apiKeyAuth requires an "Authorization: Bearer <key>" header with a valid
+// ingestion key and passes the key's domain on in the request context.
+func (s *Server) apiKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || key == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domain, ok, err := s.db.UseAPIKey(r.Context(), hashAPIKey(key))
+		if err != nil {
+			logging.InternalError(w, r, "Failed to check api key", err)
+			return
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyDomainKey{}, domain)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// handleIngest accepts events from backends, apps and log shippers. Unlike
+// handleEvent there is no Origin check; the client IP and User-Agent come
+// from the event itself.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2<<20) // 2MB
+
+	var req model.IngestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Events) == 0 || len(req.Events) > maxIngestEvents {
+		http.Error(w, fmt.Sprintf("events must hold 1 to %d events", maxIngestEvents), http.StatusBadRequest)
+		return
+	}
+
+	domain := r.Context().Value(apiKeyDomainKey{}).(string)
+	now := time.Now()
+
+	hits := make([]*hit, len(req.Events))
+	for i := range req.Events {
+		e := &req.Events[i]
+		if e.Domain == "" {
+			e.Domain = domain
+		}
+
+		if !validateInputData(&e.EventRequest) {
+			http.Error(w, fmt.Sprintf("Invalid event %d", i), http.StatusBadRequest)
+			return
+		}
+		if e.Domain != domain && s.sites.canonical(r.Context(), e.Domain) != s.sites.canonical(r.Context(), domain) {
+			http.Error(w, fmt.Sprintf("event %d: key is not valid for %s", i, e.Domain), http.StatusForbidden)
+			return
+		}
+		if _, err := netip.ParseAddr(e.IP); err != nil {
+			http.Error(w, fmt.Sprintf("event %d: invalid ip", i), http.StatusBadRequest)
+			return
+		}
+
+		at, ok := eventTime(e.Timestamp, now)
+		if !ok {
+			http.Error(w, fmt.Sprintf("event %d: timestamp must be within the last 24 hours", i), http.StatusBadRequest)
+			return
+		}
+
+		header := make(http.Header, len(e.Headers)+1)
+		for k, v := range e.Headers {
+			header.Set(k, v)
+		}
+		header.Set("User-Agent", e.UserAgent)
+
+		hits[i] = &hit{event: &e.EventRequest, ip: e.IP, header: header, at: at}
+	}
+
+	resp, err := s.processAll(r.Context(), hits)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to process ingested events", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// processAll runs hits through the pipeline and stores them in a single
+// transaction, so a failed request stores nothing and can safely be retried
+// as a whole. Hits are prepared first, the transaction holds the only
+// connection the request uses while it is open.
+func (s *Server) processAll(ctx context.Context, hits []*hit) (model.IngestResponse, error) {
+	var resp model.IngestResponse
+	ready := make([]*prepared, len(hits))
+	for i, h := range hits {
+		p, err := s.prepare(ctx, h)
+		if err != nil {
+			return resp, err
+		}
+		ready[i] = p
+		if p.reason != "" {
+			resp.Filtered++
+		} else {
+			resp.Accepted++
+		}
+	}
+
+	err := s.db.WithTx(ctx, func(tx *storage.DB) error {
+		for _, p := range ready {
+			if err := s.store(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return resp, err
+}
+
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.db.ListAPIKeys(r.Context(), r.PathValue("domain"))
+	if err != nil {
+		logging.InternalError(w, r, "Failed to list api keys", err)
+		return
+	}
+
+	writeJSON(w, keys)
+}
+
+// handleCreateAPIKey generates a key for the domain. The key is returned in
+// this response only, the database keeps just its hash.
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<10) // 10KB
+
+	var key model.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	key.Domain = r.PathValue("domain")
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logging.InternalError(w, r, "Failed to generate api key", err)
+		return
+	}
+	key.Key = "vk_" + hex.EncodeToString(secret)
+
+	if err := s.db.InsertAPIKey(r.Context(), &key, hashAPIKey(key.Key)); err != nil {
+		logging.InternalError(w, r, "Failed to create api key", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.db.DeleteAPIKey(r.Context(), r.PathValue("domain"), id)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to delete api key", err)
+		return
+	}
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,21 +1,121 @@
 package server
 
 import (
+	"crypto/rand"
 	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+	"visitor/internal/logging"
 )
 
+// requestIDRe accepts request IDs from proxies in front of the server.
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags each request with an ID, taken from a valid X-Request-ID
+// header or generated, which is echoed in the response and logged with every
+// record of the request.
+func (s *Server) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRe.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// FlushError flushes the underlying writer, which sends the headers too.
+func (rec *statusRecorder) FlushError() error {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// accessLog logs each request once it is answered.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.InfoContext(r.Context(), "Request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", r.URL.RawQuery,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start))
+	})
+}
+
+// stats protects a stats API handler and logs its requests.
+func (s *Server) stats(h http.HandlerFunc) http.Handler {
+	return s.accessLog(s.auth(h))
+}
+
+// trackerPaths are the endpoints the tracker posts to. They answer every site
+// they accept events from, with credentials for the ignore cookie, so the
+// tracker can tell whether a batch was stored.
+var trackerPaths = map[string]bool{
+	"/api/event":        true,
+	"/api/events/batch": true,
+}
+
 func (s *Server) cors(next http.Handler) http.Handler {
 	return http.HandlerFunc((func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 
 		if origin != "" {
-			for domain := range s.allowedDomains {
-				if origin == "http://"+domain || origin == "https://"+domain {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					w.Header().Set("Vary", "Origin")
-					break
-				}
+			u, err := url.Parse(origin)
+			valid := err == nil && (u.Scheme == "http" || u.Scheme == "https")
+			switch {
+			case valid && trackerPaths[r.URL.Path] && s.isAllowedDomain(r.Context(), u.Hostname()):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Vary", "Origin")
+			case valid && len(s.allowedDomains) > 0 && s.allowedHost(r.Context(), u.Hostname()):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Vary", "Origin")
 			}
 		}
 
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"visitor/web"
+)
+
+var optOutTemplate = template.Must(template.New("opt-out").Parse(web.OptOutHTML))
+
+type optOutPage struct {
+	Host      string
+	OptOutURL string
+	OptInURL  string
+}
+
+// handleOptOut serves the page site owners link to as
+// /opt-out?return=https://example.com/privacy. The tracker only stores the
+// choice in the site's own localStorage, so the page links back to the site
+// with a #visitor-opt-out or #visitor-opt-in fragment the tracker acts on.
+func (s *Server) handleOptOut(w http.ResponseWriter, r *http.Request) {
+	var page optOutPage
+
+	ret, err := url.Parse(r.URL.Query().Get("return"))
+	if err == nil && (ret.Scheme == "http" || ret.Scheme == "https") && s.isAllowedDomain(r.Context(), ret.Hostname()) {
+		ret.Fragment = "visitor-opt-out"
+		page.OptOutURL = ret.String()
+		ret.Fragment = "visitor-opt-in"
+		page.OptInURL = ret.String()
+		page.Host = ret.Hostname()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := optOutTemplate.Execute(w, page); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to render opt-out page", "err", err)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"visitor/internal/bot"
+	"visitor/internal/client"
+	"visitor/internal/geoip"
+	"visitor/internal/model"
+	"visitor/internal/referrer"
+	"visitor/internal/storage"
+
+	"github.com/mssola/useragent"
+)
+
+// Filtered hit reasons raised by the server itself, next to bot.Reason*.
+const (
+	reasonDatacenter   = "datacenter"
+	reasonDNT          = "dnt"
+	reasonGPC          = "gpc"
+	reasonOptOut       = "opt_out"
+	reasonIgnoreCookie = "ignore_cookie"
+	reasonExcludedIP   = "excluded_ip"
+	reasonExcludedPath = "excluded_path"
+)
+
+// hit is a validated event on its way through the ingestion pipeline,
+// together with the client that caused it.
+type hit struct {
+	event  *model.EventRequest
+	ip     string
+	header http.Header
+	at     time.Time
+	// browser is set for hits sent by the tracker itself, which makes the
+	// ignore cookie and the browser-header bot heuristics apply.
+	browser bool
+}
+
+// prepared is a hit with everything resolved that needs the site cache or
+// the hasher, so storing it takes no connection besides db's.
+type prepared struct {
+	*hit
+	domain   string
+	hostname string
+	config   *siteConfig
+	ua       *useragent.UserAgent
+	network  geoip.Network
+	// reason is why the hit is filtered out, or "" to store it.
+	reason      string
+	visitorHash string
+	ref         referrer.Referrer
+}
+
+// process filters, enriches and stores a hit through db, which is either
+// s.db or a transaction. It returns the reason the hit was filtered out, or
+// "" when it was stored.
+func (s *Server) process(ctx context.Context, db *storage.DB, h *hit) (string, error) {
+	p, err := s.prepare(ctx, h)
+	if err != nil {
+		return "", err
+	}
+	return p.reason, s.store(ctx, db, p)
+}
+
+// prepare resolves the site, filters and visitor hash of a hit. It runs
+// before a transaction is opened: the site cache and the hasher read through
+// the pool, and a transaction waiting on them for a second connection could
+// exhaust it.
+func (s *Server) prepare(ctx context.Context, h *hit) (*prepared, error) {
+	event := h.event
+	// Events from aliases count towards their site, the host they were
+	// sent from is kept alongside.
+	p := &prepared{hit: h, domain: s.sites.canonical(ctx, event.Domain), hostname: h.hostname()}
+
+	config, err := s.sites.get(ctx, p.domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site settings: %w", err)
+	}
+	p.config = config
+
+	userAgent := h.header.Get("User-Agent")
+	p.ua = useragent.New(userAgent)
+	p.network = s.geoip.Network(h.ip)
+
+	if p.reason = s.filterReason(h, config, p.ua, p.network); p.reason != "" {
+		return p, nil
+	}
+
+	p.visitorHash, err = s.hasher.GetHash(ctx, p.domain, h.ip, userAgent, h.at)
+	if err != nil {
+		return nil, fmt.Errorf("get visitor hash: %w", err)
+	}
+
+	p.ref, _ = referrer.Parse(event.Referrer, p.domain)
+	// Moving between a site's aliases is no referral either.
+	if p.ref.Host != "" && s.sites.canonical(ctx, p.ref.Host) == p.domain {
+		p.ref = referrer.Referrer{}
+	}
+	return p, nil
+}
+
+// store writes a prepared hit through db.
+func (s *Server) store(ctx context.Context, db *storage.DB, p *prepared) error {
+	event := p.event
+
+	if p.reason != "" {
+		// Only page views and the opt-out itself are counted, a filtered
+		// visitor's clicks and engagement pings would count them again.
+		if !counted(event.Type, p.reason) {
+			return nil
+		}
+		// A failed statement aborts the surrounding transaction, so the error
+		// can't just be logged.
+		if err := db.CountFiltered(ctx, p.domain, p.reason, p.at, p.config.site.Timezone); err != nil {
+			return fmt.Errorf("count filtered hit: %w", err)
+		}
+		return nil
+	}
+
+	switch event.Type {
+	case model.EventEngagement:
+		if err := db.UpdateEngagement(ctx, p.domain, p.hostname, event.Path, p.visitorHash, event.ScrollDepth, event.EngagementMs, p.at); err != nil {
+			return fmt.Errorf("update engagement: %w", err)
+		}
+		return nil
+
+	case model.EventOutbound, model.EventDownload:
+		le := &model.LinkEvent{
+			Domain:      p.domain,
+			Type:        event.Type,
+			URL:         stripQuery(event.URL),
+			Path:        event.Path,
+			VisitorHash: p.visitorHash,
+			CreatedAt:   p.at,
+		}
+
+		if err := db.InsertLinkEvent(ctx, le); err != nil {
+			return fmt.Errorf("insert link event: %w", err)
+		}
+		return nil
+	}
+
+	info := client.Parse(p.ua, p.header)
+	ref := p.ref
+
+	pv := &model.PageView{
+		Domain:         p.domain,
+		Hostname:       p.hostname,
+		Path:           event.Path,
+		Referrer:       ref.URL,
+		ReferrerHost:   ref.Host,
+		ReferrerSource: ref.Source,
+		Channel:        referrer.Channel(ref, event.UTMSource, event.UTMMedium),
+		ScreenSize:     event.ScreenSize,
+		UTMSource:      strings.TrimSpace(event.UTMSource),
+		UTMMedium:      strings.TrimSpace(event.UTMMedium),
+		UTMCampaign:    strings.TrimSpace(event.UTMCampaign),
+		UTMTerm:        strings.TrimSpace(event.UTMTerm),
+		UTMContent:     strings.TrimSpace(event.UTMContent),
+		CountryCode:    s.geoip.Country(p.ip),
+		Browser:        info.Browser,
+		BrowserVersion: info.BrowserVersion,
+		OS:             info.OS,
+		OSVersion:      info.OSVersion,
+		DeviceType:     info.DeviceType,
+		ASN:            int64(p.network.ASN),
+		ASNOrg:         p.network.Organization,
+		IsDatacenter:   p.network.Hosting,
+		VisitorHash:    p.visitorHash,
+		CreatedAt:      p.at,
+	}
+
+	if err := db.InsertPageView(ctx, pv); err != nil {
+		return fmt.Errorf("insert page view: %w", err)
+	}
+	return nil
+}
+
+// filterReason returns why a hit must not be stored, or "" to keep it.
+func (s *Server) filterReason(h *hit, config *siteConfig, ua *useragent.UserAgent, network geoip.Network) string {
+	event := h.event
+	site := config.site
+
+	if h.browser {
+		if _, err := h.cookie(ignoreCookie); err == nil {
+			return reasonIgnoreCookie
+		}
+	}
+	if config.exclusions.MatchIP(h.ip) {
+		return reasonExcludedIP
+	}
+	if config.exclusions.MatchPath(event.Path) {
+		return reasonExcludedPath
+	}
+	if site.HonorDNT && h.header.Get("DNT") == "1" {
+		return reasonDNT
+	}
+	if site.HonorGPC && h.header.Get("Sec-GPC") == "1" {
+		return reasonGPC
+	}
+
+	if h.browser {
+		if reason := bot.Detect(ua, h.header); reason != "" {
+			return reason
+		}
+	} else if reason := bot.DetectUserAgent(ua); reason != "" {
+		return reason
+	}
+
+	if network.Hosting && site.DatacenterTraffic == model.DatacenterDrop {
+		return reasonDatacenter
+	}
+	// Checked last, so visitors that were never counted don't show up as
+	// opt-outs.
+	if event.Type == model.EventOptOut {
+		return reasonOptOut
+	}
+	return ""
+}
+
+// counted reports whether a filtered event of eventType counts towards the
+// filtered hits.
+func counted(eventType, reason string) bool {
+	switch eventType {
+	case "", model.EventPageView:
+		return true
+	case model.EventOptOut:
+		return reason == reasonOptOut
+	default:
+		return false
+	}
+}
+
+// hostname returns the host, with its port, the hit happened on. Browsers
+// name it in the Origin header, which page scripts can't set; otherwise the
+// event's hostname field is used, falling back to its domain.
+func (h *hit) hostname() string {
+	if h.browser {
+		if origin, err := url.Parse(h.header.Get("Origin")); err == nil && origin.Host != "" {
+			return strings.ToLower(origin.Host)
+		}
+	}
+	if h.event.Hostname != "" {
+		return strings.ToLower(h.event.Hostname)
+	}
+	return model.NormalizeHost(h.event.Domain)
+}
+
+// cookie reads a cookie from the hit's request headers.
+func (h *hit) cookie(name string) (*http.Cookie, error) {
+	r := http.Request{Header: h.header}
+	return r.Cookie(name)
+}
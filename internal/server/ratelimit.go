@@ -60,11 +60,15 @@ func (rl *rateLimiter) cleanup() {
 	}
 }
 
+// allowN takes n tokens from the bucket of r's client, if it holds them.
+func (rl *rateLimiter) allowN(r *http.Request, n int) bool {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return rl.getLimiter(ip).AllowN(time.Now(), n)
+}
+
 func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-
-		if !rl.getLimiter(ip).Allow() {
+		if !rl.allowN(r, 1) {
 			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
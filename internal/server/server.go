@@ -1,26 +1,30 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/fs"
-	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"visitor/internal/client"
 	"visitor/internal/dashboard"
 	"visitor/internal/geoip"
 	"visitor/internal/hash"
+	"visitor/internal/logging"
 	"visitor/internal/model"
 	"visitor/internal/storage"
 	"visitor/web"
-
-	"github.com/mssola/useragent"
 )
 
 var screenSizeRe = regexp.MustCompile(`^\d+x\d+$`)
 
+var hostnameRe = regexp.MustCompile(`^[a-zA-Z0-9.-]{1,253}(:\d{1,5})?$`)
+
 type Server struct {
 	addr			string
 	db 				*storage.DB
@@ -30,6 +34,10 @@ type Server struct {
 	password 		string
 	allowedDomains 	map[string]bool
 	limiter			*rateLimiter
+	// batchLimiter charges batches per event. It has the rate of limiter,
+	// but a burst of a full batch.
+	batchLimiter	*rateLimiter
+	sites			*siteCache
 }
 
 func New(addr string, db *storage.DB, hasher *hash.Manager, geoip *geoip.Resolver,password string, allowedDomains string) *Server {
@@ -37,7 +45,7 @@ func New(addr string, db *storage.DB, hasher *hash.Manager, geoip *geoip.Resolve
 
 	domains := make(map[string]bool)
 	for d := range strings.SplitSeq(allowedDomains, ",") {
-		d = strings.TrimSpace(d)
+		d = model.NormalizeHost(strings.TrimSpace(d))
 		if d != "" {
 			domains[d] = true
 		}
@@ -52,19 +60,54 @@ func New(addr string, db *storage.DB, hasher *hash.Manager, geoip *geoip.Resolve
 		password: 		password,
 		allowedDomains: domains,
 		limiter: 		newRateLimiter(5, 10),
+		batchLimiter: 	newRateLimiter(5, maxBatchEvents),
+		sites: 			newSiteCache(db),
 	}
 
 	s.mux.Handle("POST /api/event", s.limiter.middleware(http.HandlerFunc(s.handleEvent)))
+	s.mux.Handle("POST /api/events/batch", s.batchLimiter.middleware(http.HandlerFunc(s.handleBatch)))
+	s.mux.Handle("POST /api/ingest", s.apiKeyAuth(http.HandlerFunc(s.handleIngest)))
 	s.mux.HandleFunc("GET /tracker.js", s.handleTracker)
-
-	dash := dashboard.NewHandler(dashboard.NewQueries(db.Pool()))
-	s.mux.Handle("GET /api/stats/summary", s.auth(http.HandlerFunc(dash.HandleSummary)))
-	s.mux.Handle("GET /api/stats/pages", s.auth(http.HandlerFunc(dash.HandlePages)))
-	s.mux.Handle("GET /api/stats/referrers", s.auth(http.HandlerFunc(dash.HandleReferrers)))
-	s.mux.Handle("GET /api/stats/locations", s.auth(http.HandlerFunc(dash.HandleLocations)))
-	s.mux.Handle("GET /api/stats/sizes", s.auth(http.HandlerFunc(dash.HandleSizes)))
-	s.mux.Handle("GET /api/stats/browsers", s.auth(http.HandlerFunc(dash.HandleBrowsers)))
-	s.mux.Handle("GET /api/stats/systems", s.auth(http.HandlerFunc(dash.HandleSystems)))
+	s.mux.HandleFunc("GET /opt-out", s.handleOptOut)
+
+	dash := dashboard.NewHandler(dashboard.NewQueries(db.Pool()), s.sites.canonical, db.KnownTimezone)
+	s.mux.Handle("GET /api/stats/summary", s.stats(dash.HandleSummary))
+	s.mux.Handle("GET /api/stats/pages", s.stats(dash.HandlePages))
+	s.mux.Handle("GET /api/stats/referrers", s.stats(dash.HandleReferrers))
+	s.mux.Handle("GET /api/stats/sources", s.stats(dash.HandleSources))
+	s.mux.Handle("GET /api/stats/channels", s.stats(dash.HandleChannels))
+	s.mux.Handle("GET /api/stats/locations", s.stats(dash.HandleLocations))
+	s.mux.Handle("GET /api/stats/sizes", s.stats(dash.HandleSizes))
+	s.mux.Handle("GET /api/stats/browsers", s.stats(dash.HandleBrowsers))
+	s.mux.Handle("GET /api/stats/systems", s.stats(dash.HandleSystems))
+	s.mux.Handle("GET /api/stats/utm/sources", s.stats(dash.HandleUTMSources))
+	s.mux.Handle("GET /api/stats/utm/mediums", s.stats(dash.HandleUTMMediums))
+	s.mux.Handle("GET /api/stats/utm/campaigns", s.stats(dash.HandleUTMCampaigns))
+	s.mux.Handle("GET /api/stats/outbound", s.stats(dash.HandleOutbound))
+	s.mux.Handle("GET /api/stats/downloads", s.stats(dash.HandleDownloads))
+	s.mux.Handle("GET /api/stats/devices", s.stats(dash.HandleDevices))
+	s.mux.Handle("GET /api/stats/networks", s.stats(dash.HandleNetworks))
+	s.mux.Handle("GET /api/stats/hosts", s.stats(dash.HandleHosts))
+	s.mux.Handle("GET /api/stats/filtered", s.stats(dash.HandleFiltered))
+	s.mux.Handle("GET /api/stats/timeseries", s.stats(dash.HandleTimeSeries))
+	s.mux.Handle("GET /api/stats/overview", s.stats(dash.HandleOverview))
+	s.mux.Handle("GET /api/export", s.stats(dash.HandleExport))
+	s.mux.Handle("GET /api/export/events", s.stats(dash.HandleExportEvents))
+
+	s.mux.Handle("GET /api/sites", s.auth(http.HandlerFunc(s.handleListSites)))
+	s.mux.Handle("GET /api/sites/{domain}", s.auth(http.HandlerFunc(s.handleGetSite)))
+	s.mux.Handle("PUT /api/sites/{domain}", s.auth(http.HandlerFunc(s.handleUpdateSite)))
+	s.mux.Handle("GET /api/sites/{domain}/exclusions", s.auth(http.HandlerFunc(s.handleListExclusions)))
+	s.mux.Handle("POST /api/sites/{domain}/exclusions", s.auth(http.HandlerFunc(s.handleCreateExclusion)))
+	s.mux.Handle("DELETE /api/sites/{domain}/exclusions/{id}", s.auth(http.HandlerFunc(s.handleDeleteExclusion)))
+
+	s.mux.Handle("GET /api/sites/{domain}/keys", s.auth(http.HandlerFunc(s.handleListAPIKeys)))
+	s.mux.Handle("POST /api/sites/{domain}/keys", s.auth(http.HandlerFunc(s.handleCreateAPIKey)))
+	s.mux.Handle("DELETE /api/sites/{domain}/keys/{id}", s.auth(http.HandlerFunc(s.handleDeleteAPIKey)))
+
+	s.mux.Handle("GET /api/ignore-me", s.auth(http.HandlerFunc(s.handleGetIgnore)))
+	s.mux.Handle("PUT /api/ignore-me", s.auth(http.HandlerFunc(s.handleSetIgnore)))
+	s.mux.Handle("DELETE /api/ignore-me", s.auth(http.HandlerFunc(s.handleSetIgnore)))
 
 
 
@@ -77,13 +120,19 @@ func New(addr string, db *storage.DB, hasher *hash.Manager, geoip *geoip.Resolve
 		w.Write(data)
 	})))
 
+	s.mux.Handle("GET /overview", s.auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		data, _ := web.StaticFS.ReadFile("static/overview.html")
+		w.Write(data)
+	})))
+
 	return s
 }
 
 func (s *Server) Start() error {
 	srv := &http.Server{
 		Addr: 			s.addr,
-		Handler: 		s.cors(s.mux),
+		Handler: 		s.requestID(s.cors(s.mux)),
 		ReadTimeout: 	5 * time.Second,
 		WriteTimeout: 	10 * time.Second,
 		IdleTimeout: 	120 * time.Second,
@@ -101,69 +150,140 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !validateInputData(event.Domain, event.Path, event.Referrer, event.ScreenSize) {
+	if !validateInputData(&event) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if !s.isAllowedDomain(event.Domain) {
+	if !s.isAllowedDomain(r.Context(), event.Domain) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	origin := r.Header.Get("Origin")
-	if origin != "http://"+event.Domain && origin != "https://"+event.Domain {
+	if !s.allowedOrigin(r, event.Domain) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	ip := extractIP(r)
+	h := &hit{
+		event:   &event,
+		ip:      extractIP(r),
+		header:  r.Header,
+		at:      time.Now(),
+		browser: true,
+	}
 
-	userAgent := r.Header.Get("User-Agent")
+	if _, err := s.process(r.Context(), s.db, h); err != nil {
+		logging.InternalError(w, r, "Failed to process event", err)
+		return
+	}
 
-	visitorHash, err := s.hasher.GetHash(r.Context(), event.Domain, ip, userAgent)
-	if err != nil {
-		log.Printf("failed to get visitor hash: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleBatch accepts events the tracker queued while offline. Each event
+// carries the time it happened. Invalid events are skipped and listed in the
+// response, the rest is stored together so the tracker knows whether to keep
+// its queue.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 256<<10) // 256KB
+
+	var req model.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
-	countryCode := s.geoip.Country(ip)
-	ua := useragent.New(userAgent)
-	browser, _ := ua.Browser()
-	os := ua.OS()
+	if len(req.Events) == 0 || len(req.Events) > maxBatchEvents {
+		http.Error(w, fmt.Sprintf("events must hold 1 to %d events", maxBatchEvents), http.StatusBadRequest)
+		return
+	}
+	// Charged per event, a batch mustn't get around the limit of /api/event.
+	// The middleware took the first one.
+	if len(req.Events) > 1 && !s.batchLimiter.allowN(r, len(req.Events)-1) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	ip := extractIP(r)
+	now := time.Now()
+
+	// One bad event must not keep the rest of the queue from being stored.
+	var hits []*hit
+	var rejected []int
+	for i := range req.Events {
+		e := &req.Events[i]
+		at, ok := eventTime(&e.Timestamp, now)
+		if !validateInputData(&e.EventRequest) || e.Timestamp.IsZero() || !ok ||
+			!s.isAllowedDomain(r.Context(), e.Domain) || !s.allowedOrigin(r, e.Domain) {
+			rejected = append(rejected, i)
+			continue
+		}
 
-	pv := &model.PageView{
-		Domain: 		event.Domain,
-		Path: 			event.Path,
-		Referrer: 		event.Referrer,
-		ScreenSize: 	event.ScreenSize,
-		CountryCode: 	countryCode,	
-		Browser:        browser,
-		OS: 			os,	
-		VisitorHash: 	visitorHash,
+		hits = append(hits, &hit{event: &e.EventRequest, ip: ip, header: r.Header, at: at, browser: true})
 	}
 
-	if err := s.db.InsertPageView(r.Context(), pv); err != nil {
-		log.Printf("Failed to insert page view: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	resp, err := s.processAll(r.Context(), hits)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to process event batch", err)
 		return
 	}
+	resp.Rejected = rejected
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) handleTracker(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-type", "application/javascript")
 	w.Header().Set("Cache-Control", "public, max-age=86400")
+	// Browsers only act on Accept-CH from the embedding page, see the README;
+	// here it just names the hints the tracker can use.
+	w.Header().Set("Accept-CH", client.AcceptCH)
 	w.Write(web.TrackerJS)
 }
 
-func (s *Server) isAllowedDomain(domain string) bool {
+func (s *Server) isAllowedDomain(ctx context.Context, domain string) bool {
     if len(s.allowedDomains) == 0 {
         return true
     }
-    return s.allowedDomains[domain]
+    return s.allowedHost(ctx, domain)
+}
+
+// allowedHost reports whether host, or the site it is an alias of, matches
+// an entry of the allowed domains. Entries may be "*.example.com" patterns.
+func (s *Server) allowedHost(ctx context.Context, host string) bool {
+	host = model.NormalizeHost(host)
+	if s.matchAllowed(host) {
+		return true
+	}
+	site := s.sites.canonical(ctx, host)
+	return site != host && s.matchAllowed(site)
+}
+
+func (s *Server) matchAllowed(host string) bool {
+	if s.allowedDomains[host] {
+		return true
+	}
+	for pattern := range s.allowedDomains {
+		if model.MatchDomain(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigin reports whether a browser request comes from the site it
+// reports events for, or from one of the site's aliases.
+func (s *Server) allowedOrigin(r *http.Request, domain string) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || (origin.Scheme != "http" && origin.Scheme != "https") {
+		return false
+	}
+	host := model.NormalizeHost(origin.Hostname())
+	domain = model.NormalizeHost(domain)
+	return host == domain || s.sites.canonical(r.Context(), host) == s.sites.canonical(r.Context(), domain)
 }
 
 func extractIP(r *http.Request) string {
@@ -177,18 +297,56 @@ func extractIP(r *http.Request) string {
 	return ip
 }
 
-func validateInputData(domain string, path string, referrer string, screenSize string) bool {
-	if domain == "" || len(domain) > 253 {
+func validateInputData(event *model.EventRequest) bool {
+	if event.Domain == "" || len(event.Domain) > 253 {
+		return false
+	}
+	if event.Hostname != "" && !hostnameRe.MatchString(event.Hostname) {
 		return false
 	}
-	if !strings.HasPrefix(path, "/") || len(path) > 2048 {
+	if !strings.HasPrefix(event.Path, "/") || len(event.Path) > 2048 {
 		return false
 	}
-	if len(referrer) > 2048 {
+	if len(event.Referrer) > 2048 {
 		return false
 	}
-	if screenSize != "" && !screenSizeRe.MatchString(screenSize) {
+	if event.ScreenSize != "" && !screenSizeRe.MatchString(event.ScreenSize) {
+		return false
+	}
+	for _, v := range []string{event.UTMSource, event.UTMMedium, event.UTMCampaign, event.UTMTerm, event.UTMContent} {
+		if len(v) > 256 {
+			return false
+		}
+	}
+
+	switch event.Type {
+	case "", model.EventPageView, model.EventOptOut:
+	case model.EventOutbound, model.EventDownload:
+		u, err := url.Parse(event.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(event.URL) > 2048 {
+			return false
+		}
+	case model.EventEngagement:
+		if event.ScrollDepth < 0 || event.ScrollDepth > 100 {
+			return false
+		}
+		if event.EngagementMs < 0 || event.EngagementMs > int64(24*time.Hour/time.Millisecond) {
+			return false
+		}
+	default:
 		return false
 	}
 	return true
+}
+
+// stripQuery drops the query string and fragment from a link URL, they
+// regularly carry tokens and personal data.
+func stripQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
 }
\ No newline at end of file
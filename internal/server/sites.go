@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"visitor/internal/logging"
+	"visitor/internal/model"
+	"visitor/internal/storage"
+)
+
+const siteCacheTTL = time.Minute
+
+// maxCachedSites bounds the site cache. Without ALLOWED_DOMAINS any domain
+// can be posted, so the cache can't hold every one it is asked for.
+const maxCachedSites = 10000
+
+// siteConfig is everything ingestion needs to know about a site.
+type siteConfig struct {
+	site       *model.Site
+	exclusions *model.Exclusions
+}
+
+type cachedSite struct {
+	config   *siteConfig
+	loadedAt time.Time
+}
+
+// aliasIndex is a site index and when it was loaded.
+type aliasIndex struct {
+	*model.SiteIndex
+	loadedAt time.Time
+}
+
+// siteCache keeps per-site settings and exclusion rules in memory so
+// ingestion doesn't hit the database for every event. Entries expire after
+// siteCacheTTL and are dropped immediately when changed through the admin API.
+// Expired entries are removed at most once per siteCacheTTL, and a full cache
+// takes no new ones until then.
+type siteCache struct {
+	mu      sync.Mutex
+	db      *storage.DB
+	sites   map[string]cachedSite
+	sweptAt time.Time
+	aliases *aliasIndex
+}
+
+func newSiteCache(db *storage.DB) *siteCache {
+	return &siteCache{
+		db:    db,
+		sites: make(map[string]cachedSite),
+	}
+}
+
+func (c *siteCache) get(ctx context.Context, domain string) (*siteConfig, error) {
+	c.mu.Lock()
+	cached, ok := c.sites[domain]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.loadedAt) < siteCacheTTL {
+		return cached.config, nil
+	}
+
+	site, err := c.db.GetSite(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := c.db.ListExclusionRules(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &siteConfig{site: site, exclusions: model.CompileExclusions(rules)}
+
+	c.mu.Lock()
+	c.store(domain, config)
+	c.mu.Unlock()
+
+	return config, nil
+}
+
+// store caches config for domain. c.mu must be held.
+func (c *siteCache) store(domain string, config *siteConfig) {
+	now := time.Now()
+	if now.Sub(c.sweptAt) >= siteCacheTTL {
+		for d, cached := range c.sites {
+			if now.Sub(cached.loadedAt) >= siteCacheTTL {
+				delete(c.sites, d)
+			}
+		}
+		c.sweptAt = now
+	}
+
+	if _, ok := c.sites[domain]; !ok && len(c.sites) >= maxCachedSites {
+		return
+	}
+	c.sites[domain] = cachedSite{config: config, loadedAt: now}
+}
+
+// canonical returns the site domain events for host are recorded under.
+// When the aliases can't be loaded the last known ones are used.
+func (c *siteCache) canonical(ctx context.Context, host string) string {
+	host = model.NormalizeHost(host)
+
+	c.mu.Lock()
+	idx := c.aliases
+	c.mu.Unlock()
+
+	if idx == nil || time.Since(idx.loadedAt) >= siteCacheTTL {
+		loaded, err := c.loadAliases(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to load site aliases", "err", err)
+		} else {
+			idx = loaded
+			c.mu.Lock()
+			c.aliases = idx
+			c.mu.Unlock()
+		}
+	}
+	if idx == nil {
+		return host
+	}
+	return idx.Resolve(host)
+}
+
+func (c *siteCache) loadAliases(ctx context.Context) (*aliasIndex, error) {
+	sites, err := c.db.ListSites(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &aliasIndex{SiteIndex: model.NewSiteIndex(sites), loadedAt: time.Now()}
+	return idx, nil
+}
+
+func (c *siteCache) invalidate(domain string) {
+	c.mu.Lock()
+	delete(c.sites, domain)
+	c.aliases = nil
+	c.mu.Unlock()
+}
+
+func (s *Server) handleListSites(w http.ResponseWriter, r *http.Request) {
+	sites, err := s.db.ListSites(r.Context())
+	if err != nil {
+		logging.InternalError(w, r, "Failed to list sites", err)
+		return
+	}
+
+	writeJSON(w, sites)
+}
+
+func (s *Server) handleGetSite(w http.ResponseWriter, r *http.Request) {
+	config, err := s.sites.get(r.Context(), r.PathValue("domain"))
+	if err != nil {
+		logging.InternalError(w, r, "Failed to get site", err)
+		return
+	}
+
+	writeJSON(w, config.site)
+}
+
+func (s *Server) handleUpdateSite(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<10) // 10KB
+
+	domain := r.PathValue("domain")
+	config, err := s.sites.get(r.Context(), domain)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to get site", err)
+		return
+	}
+
+	// Decode on top of the current settings so partial updates keep the rest.
+	updated := *config.site
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	updated.Domain = domain
+
+	if updated.DatacenterTraffic != model.DatacenterTag && updated.DatacenterTraffic != model.DatacenterDrop {
+		http.Error(w, "datacenter_traffic must be tag or drop", http.StatusBadRequest)
+		return
+	}
+	if !model.ValidTimezone(updated.Timezone) {
+		http.Error(w, "timezone must be an IANA timezone name", http.StatusBadRequest)
+		return
+	}
+	known, err := s.db.KnownTimezone(r.Context(), updated.Timezone)
+	if err != nil {
+		logging.InternalError(w, r, "Failed to check timezone", err)
+		return
+	}
+	if !known {
+		http.Error(w, "timezone is not known to the database", http.StatusBadRequest)
+		return
+	}
+
+	sites, err := s.db.ListSites(r.Context())
+	if err != nil {
+		logging.InternalError(w, r, "Failed to list sites", err)
+		return
+	}
+	aliases, err := checkAliases(domain, updated.Aliases, sites)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.Aliases = aliases
+
+	if err := s.db.UpsertSite(r.Context(), &updated); err != nil {
+		logging.InternalError(w, r, "Failed to update site", err)
+		return
+	}
+	s.sites.invalidate(domain)
+
+	writeJSON(w, updated)
+}
+
+// checkAliases normalizes the aliases of domain and rejects invalid ones
+// and those another of sites already uses.
+func checkAliases(domain string, aliases []string, sites []model.Site) ([]string, error) {
+	out := []string{}
+	for _, alias := range aliases {
+		alias = model.NormalizeHost(strings.TrimSpace(alias))
+		if !model.ValidDomainPattern(alias) {
+			return nil, fmt.Errorf("invalid alias %q, use a hostname or *.example.com", alias)
+		}
+		if alias == domain || slices.Contains(out, alias) {
+			continue
+		}
+		for _, site := range sites {
+			if site.Domain != domain && (site.Domain == alias || slices.Contains(site.Aliases, alias)) {
+				return nil, fmt.Errorf("alias %q already belongs to %s", alias, site.Domain)
+			}
+		}
+		out = append(out, alias)
+	}
+	return out, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"visitor/internal/model"
+)
+
+func TestCheckAliases(t *testing.T) {
+	sites := []model.Site{
+		{Domain: "example.com", Aliases: []string{"example.net"}},
+		{Domain: "other.org", Aliases: []string{"*.other.org"}},
+	}
+
+	tests := []struct {
+		name    string
+		domain  string
+		aliases []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			domain:  "example.com",
+			aliases: nil,
+			want:    []string{},
+		},
+		{
+			name:    "normalized and deduplicated",
+			domain:  "example.com",
+			aliases: []string{" Example.NET. ", "example.net", "*.Example.com", "example.com"},
+			want:    []string{"example.net", "*.example.com"},
+		},
+		{
+			name:    "invalid hostname",
+			domain:  "example.com",
+			aliases: []string{"not a host"},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard on a top-level domain",
+			domain:  "example.com",
+			aliases: []string{"*.com"},
+			wantErr: true,
+		},
+		{
+			name:    "alias of another site",
+			domain:  "other.org",
+			aliases: []string{"example.net"},
+			wantErr: true,
+		},
+		{
+			name:    "another site's domain",
+			domain:  "example.com",
+			aliases: []string{"other.org"},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard of another site",
+			domain:  "example.com",
+			aliases: []string{"*.other.org"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkAliases(tt.domain, tt.aliases, sites)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkAliases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkAliases() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiteCacheStore(t *testing.T) {
+	c := newSiteCache(nil)
+	config := &siteConfig{site: model.DefaultSite("example.com")}
+
+	c.sites["expired.com"] = cachedSite{config: config, loadedAt: time.Now().Add(-2 * siteCacheTTL)}
+	c.store("example.com", config)
+	if _, ok := c.sites["expired.com"]; ok {
+		t.Error("store() kept an expired entry")
+	}
+
+	for i := len(c.sites); i < maxCachedSites; i++ {
+		c.store("site"+strconv.Itoa(i)+".com", config)
+	}
+	c.store("one-too-many.com", config)
+	if _, ok := c.sites["one-too-many.com"]; ok || len(c.sites) != maxCachedSites {
+		t.Errorf("store() grew the cache to %d entries, want at most %d", len(c.sites), maxCachedSites)
+	}
+
+	c.store("example.com", config)
+	if _, ok := c.sites["example.com"]; !ok {
+		t.Error("store() dropped a refreshed entry from a full cache")
+	}
+}
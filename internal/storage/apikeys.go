@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"visitor/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertAPIKey stores a new key under its hash and fills in ID and CreatedAt.
+func (db *DB) InsertAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error {
+	err := db.q.QueryRow(ctx,
+		`INSERT INTO api_keys (domain, name, key_hash) VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		key.Domain, key.Name, keyHash).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) ListAPIKeys(ctx context.Context, domain string) ([]model.APIKey, error) {
+	rows, err := db.q.Query(ctx,
+		`SELECT id, domain, name, created_at, last_used_at
+		FROM api_keys WHERE domain = $1 ORDER BY id`,
+		domain)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		var k model.APIKey
+		if err := rows.Scan(&k.ID, &k.Domain, &k.Name, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes a key and reports whether it existed.
+func (db *DB) DeleteAPIKey(ctx context.Context, domain string, id int64) (bool, error) {
+	tag, err := db.q.Exec(ctx,
+		`DELETE FROM api_keys WHERE domain = $1 AND id = $2`,
+		domain, id)
+	if err != nil {
+		return false, fmt.Errorf("delete api key: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// UseAPIKey returns the domain a key hash belongs to and records its use.
+// ok is false for unknown keys.
+func (db *DB) UseAPIKey(ctx context.Context, keyHash string) (domain string, ok bool, err error) {
+	err = db.q.QueryRow(ctx,
+		`UPDATE api_keys SET last_used_at = NOW() WHERE key_hash = $1 RETURNING domain`,
+		keyHash).Scan(&domain)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("use api key: %w", err)
+	}
+
+	return domain, true, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"visitor/internal/referrer"
+)
+
+// backfillPageSize is the number of rows a backfill reads and updates at once.
+const backfillPageSize = 5000
+
+type backfill struct {
+	name string
+	run  func(ctx context.Context, db *DB) error
+}
+
+// backfills fill new columns of existing rows with the code live ingestion
+// uses. Each runs once and is recorded in the backfills table. An
+// interrupted one starts over on the next start, so they must be idempotent.
+var backfills = []backfill{
+	{name: "referrers", run: backfillReferrers},
+	{name: "channels", run: backfillChannels},
+}
+
+// RunBackfills runs the backfills that haven't finished yet. They can take a
+// while on large tables, the server runs them in the background.
+func (db *DB) RunBackfills(ctx context.Context) error {
+	for _, b := range backfills {
+		var done bool
+		err := db.q.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM backfills WHERE name = $1)`,
+			b.name).Scan(&done)
+		if err != nil {
+			return fmt.Errorf("check backfill %s: %w", b.name, err)
+		}
+		if done {
+			continue
+		}
+
+		if err := b.run(ctx, db); err != nil {
+			return fmt.Errorf("backfill %s: %w", b.name, err)
+		}
+		if _, err := db.q.Exec(ctx, `INSERT INTO backfills (name) VALUES ($1)`, b.name); err != nil {
+			return fmt.Errorf("record backfill %s: %w", b.name, err)
+		}
+	}
+	return nil
+}
+
+// backfillReferrers normalizes the referrer of page views stored before
+// referrer parsing and sets their host and source. Self-referrals are
+// blanked, as live ingestion doesn't store them.
+func backfillReferrers(ctx context.Context, db *DB) error {
+	var after int64
+	for {
+		rows, err := db.q.Query(ctx,
+			`SELECT id, domain, referrer FROM page_views
+			 WHERE id > $1 AND referrer != ''
+			 ORDER BY id
+			 LIMIT $2`,
+			after, backfillPageSize)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		var urls, hosts, sources []string
+		for rows.Next() {
+			var id int64
+			var domain, raw string
+			if err := rows.Scan(&id, &domain, &raw); err != nil {
+				rows.Close()
+				return err
+			}
+			ref, _ := referrer.Parse(raw, domain)
+			ids = append(ids, id)
+			urls = append(urls, ref.URL)
+			hosts = append(hosts, ref.Host)
+			sources = append(sources, ref.Source)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = db.q.Exec(ctx,
+			`UPDATE page_views p
+			 SET referrer = u.url, referrer_host = u.host, referrer_source = u.source
+			 FROM unnest($1::bigint[], $2::text[], $3::text[], $4::text[]) AS u(id, url, host, source)
+			 WHERE p.id = u.id`,
+			ids, urls, hosts, sources)
+		if err != nil {
+			return err
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// backfillChannels sets the channel of page views stored before channel
+// grouping. Those have no channel, or Direct or Referral from an earlier SQL
+// backfill that didn't know the other channels; live rows with those two are
+// classified again with the same result.
+func backfillChannels(ctx context.Context, db *DB) error {
+	var after int64
+	for {
+		rows, err := db.q.Query(ctx,
+			`SELECT id, domain, referrer, utm_source, utm_medium FROM page_views
+			 WHERE id > $1 AND channel IN ('', 'Direct', 'Referral')
+			 ORDER BY id
+			 LIMIT $2`,
+			after, backfillPageSize)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		var channels []string
+		for rows.Next() {
+			var id int64
+			var domain, raw, utmSource, utmMedium string
+			if err := rows.Scan(&id, &domain, &raw, &utmSource, &utmMedium); err != nil {
+				rows.Close()
+				return err
+			}
+			ref, _ := referrer.Parse(raw, domain)
+			ids = append(ids, id)
+			channels = append(channels, referrer.Channel(ref, utmSource, utmMedium))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = db.q.Exec(ctx,
+			`UPDATE page_views p
+			 SET channel = u.channel
+			 FROM unnest($1::bigint[], $2::text[]) AS u(id, channel)
+			 WHERE p.id = u.id`,
+			ids, channels)
+		if err != nil {
+			return err
+		}
+		after = ids[len(ids)-1]
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"visitor/internal/model"
+)
+
+func (db *DB) ListExclusionRules(ctx context.Context, domain string) ([]model.ExclusionRule, error) {
+	rows, err := db.q.Query(ctx,
+		`SELECT id, domain, kind, value FROM exclusion_rules WHERE domain = $1 ORDER BY id`,
+		domain)
+	if err != nil {
+		return nil, fmt.Errorf("list exclusion rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []model.ExclusionRule
+	for rows.Next() {
+		var r model.ExclusionRule
+		if err := rows.Scan(&r.ID, &r.Domain, &r.Kind, &r.Value); err != nil {
+			return nil, fmt.Errorf("scan exclusion rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
+
+func (db *DB) InsertExclusionRule(ctx context.Context, rule *model.ExclusionRule) error {
+	err := db.q.QueryRow(ctx,
+		`INSERT INTO exclusion_rules (domain, kind, value) VALUES ($1, $2, $3) RETURNING id`,
+		rule.Domain, rule.Kind, rule.Value).Scan(&rule.ID)
+	if err != nil {
+		return fmt.Errorf("insert exclusion rule: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExclusionRule removes a rule and reports whether it existed.
+func (db *DB) DeleteExclusionRule(ctx context.Context, domain string, id int64) (bool, error) {
+	tag, err := db.q.Exec(ctx,
+		`DELETE FROM exclusion_rules WHERE domain = $1 AND id = $2`,
+		domain, id)
+	if err != nil {
+		return false, fmt.Errorf("delete exclusion rule: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
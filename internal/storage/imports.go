@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"visitor/internal/model"
+)
+
+// UpsertImportedDay stores a daily rollup, replacing the numbers of an
+// earlier import of the same day, source and path.
+func (db *DB) UpsertImportedDay(ctx context.Context, d *model.ImportedDay) error {
+	_, err := db.q.Exec(ctx,
+		`INSERT INTO imported_daily (domain, source, date, path, views, visitors)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (domain, date, source, path)
+		DO UPDATE SET views = EXCLUDED.views, visitors = EXCLUDED.visitors`,
+		d.Domain, d.Source, d.Date, d.Path, d.Views, d.Visitors)
+	if err != nil {
+		return fmt.Errorf("upsert imported day: %w", err)
+	}
+	return nil
+}
@@ -30,21 +30,130 @@ func (db *DB) migrate(ctx context.Context) error {
 			SELECT (ts AT TIME ZONE 'UTC')::date;
 		$$ LANGUAGE SQL IMMUTABLE`,
 
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_page_views_unique_visit
-			ON page_views(domain, path, visitor_hash, immutable_date(created_at))`,
-
 		`CREATE TABLE IF NOT EXISTS daily_salts (
 			date DATE PRIMARY KEY,
 			salt TEXT NOT NULL
 		)`,
 
+		// One salt per site for imported access logs, see hash.ImportHash.
+		`CREATE TABLE IF NOT EXISTS import_salts (
+			domain TEXT PRIMARY KEY,
+			salt   TEXT NOT NULL
+		)`,
+
 		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS screen_size TEXT NOT NULL DEFAULT ''`,
 		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS browser TEXT NOT NULL DEFAULT ''`,
 		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS os TEXT NOT NULL DEFAULT ''`,
+
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS asn BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS asn_org TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS is_datacenter BOOLEAN NOT NULL DEFAULT FALSE`,
+
+		`CREATE TABLE IF NOT EXISTS sites (
+			domain             TEXT PRIMARY KEY,
+			datacenter_traffic TEXT NOT NULL DEFAULT 'tag'
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS filtered_hits (
+			domain TEXT NOT NULL,
+			date   DATE NOT NULL,
+			reason TEXT NOT NULL,
+			hits   BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (domain, date, reason)
+		)`,
+
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS browser_version TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS os_version TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS device_type TEXT NOT NULL DEFAULT ''`,
+
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_source TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_medium TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_campaign TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_term TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_content TEXT NOT NULL DEFAULT ''`,
+
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS referrer_host TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS referrer_source TEXT NOT NULL DEFAULT ''`,
+
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS channel TEXT NOT NULL DEFAULT ''`,
+
+		`CREATE TABLE IF NOT EXISTS link_events (
+			id           BIGSERIAL PRIMARY KEY,
+			domain       TEXT NOT NULL,
+			type         TEXT NOT NULL,
+			url          TEXT NOT NULL,
+			path         TEXT NOT NULL DEFAULT '',
+			visitor_hash TEXT NOT NULL DEFAULT '',
+			created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_link_events_domain_type_created
+			ON link_events(domain, type, created_at)`,
+
+		// NULL until the tracker sends an engagement ping for the view.
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS scroll_depth SMALLINT`,
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS engagement_ms BIGINT`,
+
+		`ALTER TABLE sites ADD COLUMN IF NOT EXISTS honor_dnt BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE sites ADD COLUMN IF NOT EXISTS honor_gpc BOOLEAN NOT NULL DEFAULT FALSE`,
+
+		`CREATE TABLE IF NOT EXISTS exclusion_rules (
+			id         BIGSERIAL PRIMARY KEY,
+			domain     TEXT NOT NULL,
+			kind       TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_exclusion_rules_domain
+			ON exclusion_rules(domain)`,
+
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id           BIGSERIAL PRIMARY KEY,
+			domain       TEXT NOT NULL,
+			name         TEXT NOT NULL DEFAULT '',
+			key_hash     TEXT NOT NULL UNIQUE,
+			created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_used_at TIMESTAMPTZ
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS imported_daily (
+			domain   TEXT NOT NULL,
+			source   TEXT NOT NULL,
+			date     DATE NOT NULL,
+			path     TEXT NOT NULL DEFAULT '',
+			views    BIGINT NOT NULL DEFAULT 0,
+			visitors BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (domain, date, source, path)
+		)`,
+
+		// Keyset pagination for raw event exports.
+		`CREATE INDEX IF NOT EXISTS idx_page_views_domain_id
+			ON page_views(domain, id)`,
+
+		`ALTER TABLE sites ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC'`,
+
+		// Hostnames recorded under a site, see model.Site.Aliases.
+		`ALTER TABLE sites ADD COLUMN IF NOT EXISTS aliases TEXT[] NOT NULL DEFAULT '{}'`,
+		// The host a page view was recorded on, domain is the site it
+		// counts towards.
+		`ALTER TABLE page_views ADD COLUMN IF NOT EXISTS hostname TEXT NOT NULL DEFAULT ''`,
+
+		// One view per visitor, host, path and day; the same path on two
+		// hosts of a site are two views.
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_page_views_unique_host_visit
+			ON page_views(domain, hostname, path, visitor_hash, immutable_date(created_at))`,
+		`DROP INDEX IF EXISTS idx_page_views_unique_visit`,
+
+		// Data migrations that ran once, see backfills.
+		`CREATE TABLE IF NOT EXISTS backfills (
+			name   TEXT PRIMARY KEY,
+			ran_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
 	}
 
 	for _, m := range migrations {
-		if _, err := db.pool.Exec(ctx, m); err != nil {
+		if _, err := db.q.Exec(ctx, m); err != nil {
 			return fmt.Errorf("exec migration: %w", err)
 		}
 	}
@@ -3,13 +3,25 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 	"visitor/internal/model"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// querier is satisfied by both the pool and a transaction, so the same
+// methods work inside and outside of WithTx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type DB struct {
 	pool *pgxpool.Pool
+	q    querier
 }
 
 func (db *DB) Pool() *pgxpool.Pool {
@@ -27,7 +39,7 @@ func New(ctx context.Context, databaseUrl string) (*DB, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	db := &DB{pool: pool}
+	db := &DB{pool: pool, q: pool}
 
 	if err := db.migrate(ctx); err != nil {
 		pool.Close()
@@ -41,12 +53,69 @@ func (db *DB) Close() {
 	db.pool.Close()
 }
 
+// WithTx runs fn in a transaction. The DB passed to fn issues every query
+// through the transaction, which is committed when fn returns nil and rolled
+// back otherwise.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *DB) error) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&DB{pool: db.pool, q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 func (db *DB) InsertPageView(ctx context.Context, pv *model.PageView) error {
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO page_views (domain, path, referrer, country_code, screen_size, browser, os, visitor_hash)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (domain, path, visitor_hash, immutable_date(created_at)) DO NOTHING`,
-		pv.Domain, pv.Path, pv.Referrer, pv.CountryCode, pv.ScreenSize, pv.Browser, pv.OS, pv.VisitorHash)
+	_, err := db.q.Exec(ctx,
+		`INSERT INTO page_views (domain, path, referrer, referrer_host, referrer_source, channel, country_code, screen_size,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+			browser, browser_version, os, os_version, device_type,
+			asn, asn_org, is_datacenter, visitor_hash, created_at, hostname)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+		ON CONFLICT (domain, hostname, path, visitor_hash, immutable_date(created_at)) DO NOTHING`,
+		pv.Domain, pv.Path, pv.Referrer, pv.ReferrerHost, pv.ReferrerSource, pv.Channel, pv.CountryCode, pv.ScreenSize,
+		pv.UTMSource, pv.UTMMedium, pv.UTMCampaign, pv.UTMTerm, pv.UTMContent,
+		pv.Browser, pv.BrowserVersion, pv.OS, pv.OSVersion, pv.DeviceType,
+		pv.ASN, pv.ASNOrg, pv.IsDatacenter, pv.VisitorHash, pv.CreatedAt, pv.Hostname)
+
+	return err
+}
+
+func (db *DB) InsertLinkEvent(ctx context.Context, le *model.LinkEvent) error {
+	_, err := db.q.Exec(ctx,
+		`INSERT INTO link_events (domain, type, url, path, visitor_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		le.Domain, le.Type, le.URL, le.Path, le.VisitorHash, le.CreatedAt)
+
+	return err
+}
+
+// UpdateEngagement attaches scroll depth and engagement time to the visitor's
+// view of path on hostname on the day of at. Pings carry running totals, so
+// the largest wins.
+func (db *DB) UpdateEngagement(ctx context.Context, domain, hostname, path, visitorHash string, scrollDepth int, engagementMs int64, at time.Time) error {
+	_, err := db.q.Exec(ctx,
+		`UPDATE page_views
+		SET scroll_depth = GREATEST(scroll_depth, $4), engagement_ms = GREATEST(engagement_ms, $5)
+		WHERE domain = $1 AND path = $2 AND visitor_hash = $3
+			AND immutable_date(created_at) = immutable_date($6) AND hostname = $7`,
+		domain, path, visitorHash, scrollDepth, engagementMs, at, hostname)
+
+	return err
+}
+
+// CountFiltered records a hit that was dropped at ingestion, bucketed per
+// reason and day in the site's timezone.
+func (db *DB) CountFiltered(ctx context.Context, domain, reason string, at time.Time, timezone string) error {
+	_, err := db.q.Exec(ctx,
+		`INSERT INTO filtered_hits (domain, date, reason, hits)
+		VALUES ($1, ($3::timestamptz AT TIME ZONE $4)::date, $2, 1)
+		ON CONFLICT (domain, date, reason) DO UPDATE SET hits = filtered_hits.hits + 1`,
+		domain, reason, at, timezone)
 
 	return err
 }
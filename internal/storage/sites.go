@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"visitor/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const siteColumns = `domain, datacenter_traffic, honor_dnt, honor_gpc, timezone, aliases`
+
+func scanSite(row pgx.Row, s *model.Site) error {
+	return row.Scan(&s.Domain, &s.DatacenterTraffic, &s.HonorDNT, &s.HonorGPC, &s.Timezone, &s.Aliases)
+}
+
+// GetSite returns the settings for domain, or the defaults when the site has
+// never been configured.
+func (db *DB) GetSite(ctx context.Context, domain string) (*model.Site, error) {
+	site := &model.Site{}
+	err := scanSite(db.q.QueryRow(ctx,
+		`SELECT `+siteColumns+` FROM sites WHERE domain = $1`,
+		domain), site)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.DefaultSite(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+
+	return site, nil
+}
+
+func (db *DB) ListSites(ctx context.Context) ([]model.Site, error) {
+	rows, err := db.q.Query(ctx,
+		`SELECT `+siteColumns+` FROM sites ORDER BY domain`)
+	if err != nil {
+		return nil, fmt.Errorf("list sites: %w", err)
+	}
+	defer rows.Close()
+
+	var sites []model.Site
+	for rows.Next() {
+		var s model.Site
+		if err := scanSite(rows, &s); err != nil {
+			return nil, fmt.Errorf("scan site: %w", err)
+		}
+		sites = append(sites, s)
+	}
+
+	return sites, rows.Err()
+}
+
+func (db *DB) UpsertSite(ctx context.Context, site *model.Site) error {
+	_, err := db.q.Exec(ctx,
+		`INSERT INTO sites (`+siteColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (domain) DO UPDATE SET
+			datacenter_traffic = EXCLUDED.datacenter_traffic,
+			honor_dnt = EXCLUDED.honor_dnt,
+			honor_gpc = EXCLUDED.honor_gpc,
+			timezone = EXCLUDED.timezone,
+			aliases = EXCLUDED.aliases`,
+		site.Domain, site.DatacenterTraffic, site.HonorDNT, site.HonorGPC, site.Timezone, site.Aliases)
+	if err != nil {
+		return fmt.Errorf("upsert site: %w", err)
+	}
+
+	return nil
+}
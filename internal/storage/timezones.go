@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// timezones caches the zone names Postgres knows. They only change with a
+// server upgrade, so they are loaded once per process.
+var timezones struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// KnownTimezone reports whether Postgres accepts name in AT TIME ZONE. Go's
+// tzdata and the server's can differ, and a zone only Go knows would fail
+// every report.
+func (db *DB) KnownTimezone(ctx context.Context, name string) (bool, error) {
+	timezones.mu.Lock()
+	defer timezones.mu.Unlock()
+
+	if timezones.names == nil {
+		rows, err := db.q.Query(ctx, `SELECT name FROM pg_timezone_names`)
+		if err != nil {
+			return false, fmt.Errorf("list timezones: %w", err)
+		}
+		defer rows.Close()
+
+		names := make(map[string]bool)
+		for rows.Next() {
+			var n string
+			if err := rows.Scan(&n); err != nil {
+				return false, fmt.Errorf("scan timezone: %w", err)
+			}
+			names[n] = true
+		}
+		if err := rows.Err(); err != nil {
+			return false, fmt.Errorf("list timezones: %w", err)
+		}
+		timezones.names = names
+	}
+
+	return timezones.names[name], nil
+}
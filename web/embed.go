@@ -8,4 +8,7 @@ import (
 var TrackerJS []byte
 
 //go:embed static
-var StaticFS embed.FS
\ No newline at end of file
+var StaticFS embed.FS
+
+//go:embed optout/opt-out.html
+var OptOutHTML string
\ No newline at end of file
@@ -12,7 +12,15 @@
   }
 
   const domain = document.getElementById("domain");
+  // The overview links here with ?domain=, several domains are combined.
+  const linked = new URLSearchParams(location.search).get("domain");
+  if (linked) domain.value = linked;
+  const excludeDatacenter = document.getElementById("exclude-datacenter");
   let period = "7d";
+  // Names currently drilled into, "" shows the top list. A host filters the
+  // whole dashboard.
+  const drill = { browser: "", os: "", source: "", hostname: "" };
+  let utmReport = "sources";
 
   document.querySelectorAll(".periods button").forEach(function (btn) {
     btn.addEventListener("click", function () {
@@ -23,11 +31,43 @@
     });
   });
 
+  document.querySelectorAll("#utm-tabs button").forEach(function (btn) {
+    btn.addEventListener("click", function () {
+      document.querySelector("#utm-tabs .active").classList.remove("active");
+      btn.classList.add("active");
+      utmReport = btn.dataset.report;
+      refresh();
+    });
+  });
+
   domain.addEventListener("change", refresh);
 
+  // The ignore cookie lives on this server's origin, so toggling it here
+  // blocks this browser on every tracked site.
+  const ignoreMe = document.getElementById("ignore-me");
+  fetch("/api/ignore-me")
+    .then(function (r) {
+      return r.json();
+    })
+    .then(function (data) {
+      ignoreMe.checked = data.ignored;
+    });
+  ignoreMe.addEventListener("change", function () {
+    fetch("/api/ignore-me", { method: ignoreMe.checked ? "PUT" : "DELETE" });
+  });
+  excludeDatacenter.addEventListener("change", refresh);
+
+  function query() {
+    let q = "?domain=" + encodeURIComponent(domain.value);
+    q += "&period=" + period;
+    if (excludeDatacenter.checked) q += "&datacenter=exclude";
+    q += drillQuery("hostname");
+    return q;
+  }
+
   function refresh() {
-    const d = domain.value;
-    const q = "?domain=" + encodeURIComponent(d) + "&period=" + period;
+    const q = query();
+    document.getElementById("export").href = "/api/export" + q;
 
     fetch("/api/stats/summary" + q)
       .then(function (r) {
@@ -35,9 +75,13 @@
       })
       .then(function (data) {
         document.getElementById("total-views").textContent = data.total_views;
-        document.getElementById("unique-visitors").textContent =
-          data.unique_visitors;
-        renderChart(data.views_per_day || []);
+        const visitors = document.getElementById("unique-visitors");
+        visitors.textContent = data.unique_visitors;
+        // Combined sites count a visitor once per domain.
+        visitors.title = data.visitors_per_domain
+          ? "Counted per domain, a visitor of several domains counts more than once"
+          : "";
+        renderChart(data.series, data.interval);
       });
 
     fetch("/api/stats/pages" + q)
@@ -45,15 +89,24 @@
         return r.json();
       })
       .then(function (data) {
-        renderTable("pages-table", data || []);
+        renderTable("pages-table", data.rows.map(formatPage));
+        sparklines("pages-table", "page", labels(data.rows), q);
       });
 
-    fetch("/api/stats/referrers" + q)
+    // Sources drill down into the full referrer URLs of one source.
+    fetch(breakdowns["sources-table"].url(q))
       .then(function (r) {
         return r.json();
       })
       .then(function (data) {
-        renderTable("referrers-table", data || []);
+        renderDrillTitle("sources-title", "Top Sources", "source");
+        renderTable("sources-table", data.rows, drillInto("source"));
+        sparklines(
+          "sources-table",
+          drill.source ? "referrer" : "source",
+          labels(data.rows),
+          q + drillQuery("source"),
+        );
       });
 
     fetch("/api/stats/locations" + q)
@@ -61,10 +114,10 @@
         return r.json();
       })
       .then(function (data) {
-        (data || []).forEach(function (d) {
-          d.label = countryLabel(d.label);
-        });
-        renderTable("locations-table", data || []);
+        // Country codes, before they are turned into names.
+        const codes = labels(data.rows);
+        renderTable("locations-table", data.rows.map(formatLocation));
+        sparklines("locations-table", "country", codes, q);
       });
 
     fetch("/api/stats/sizes" + q)
@@ -72,43 +125,149 @@
         return r.json();
       })
       .then(function (data) {
-        renderTable("sizes-table", data || []);
+        renderTable("sizes-table", data.rows);
+        sparklines("sizes-table", "size", labels(data.rows), q);
+      });
+
+    fetch("/api/stats/browsers" + q + drillQuery("browser"))
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderDrillTitle("browsers-title", "Browsers", "browser");
+        renderTable("browsers-table", data.rows, drillInto("browser"));
+        sparklines(
+          "browsers-table",
+          drill.browser ? "browser_version" : "browser",
+          labels(data.rows),
+          q + drillQuery("browser"),
+        );
+      });
+
+    fetch("/api/stats/systems" + q + drillQuery("os"))
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderDrillTitle("systems-title", "Systems", "os");
+        renderTable("systems-table", data.rows, drillInto("os"));
+        sparklines(
+          "systems-table",
+          drill.os ? "os_version" : "os",
+          labels(data.rows),
+          q + drillQuery("os"),
+        );
+      });
+
+    fetch("/api/stats/channels" + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderTable("channels-table", data.rows);
+        sparklines("channels-table", "channel", labels(data.rows), q);
+      });
+
+    fetch("/api/stats/utm/" + utmReport + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderTable("utm-table", data.rows);
+        // "sources" -> "utm_source"
+        const dimension = "utm_" + utmReport.slice(0, -1);
+        sparklines("utm-table", dimension, labels(data.rows), q);
+      });
+
+    fetch("/api/stats/devices" + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderTable("devices-table", data.rows);
+        sparklines("devices-table", "device", labels(data.rows), q);
+      });
+
+    fetch("/api/stats/networks" + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderTable("networks-table", data.rows);
+        sparklines("networks-table", "network", labels(data.rows), q);
+      });
+
+    fetch("/api/stats/hosts" + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderDrillTitle("hosts-title", "Hosts", "hostname");
+        renderTable("hosts-table", data.rows, drillInto("hostname"));
+        sparklines("hosts-table", "hostname", labels(data.rows), q);
+      });
+
+    fetch("/api/stats/outbound" + q)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderTable("outbound-table", data.rows);
       });
 
-    fetch("/api/stats/browsers" + q)
+    fetch("/api/stats/downloads" + q)
       .then(function (r) {
         return r.json();
       })
       .then(function (data) {
-        renderTable("browsers-table", data || []);
+        renderTable("downloads-table", data.rows);
       });
 
-    fetch("/api/stats/systems" + q)
+    fetch("/api/stats/filtered" + q)
       .then(function (r) {
         return r.json();
       })
       .then(function (data) {
-        renderTable("systems-table", data || []);
+        var totals = {};
+        (data || []).forEach(function (d) {
+          totals[d.reason] = (totals[d.reason] || 0) + d.hits;
+        });
+        renderTable(
+          "filtered-table",
+          Object.keys(totals).map(function (reason) {
+            return { reason: reason, hits: totals[reason] };
+          }),
+        );
       });
   }
 
-  function renderChart(days) {
+  // bucketLabel shortens a bucket start ("2024-03-10" or "2024-03-10T14:00")
+  // for the chart axis.
+  function bucketLabel(start, interval) {
+    if (interval === "hour") return start.slice(11); // HH:MM
+    if (interval === "month") return start.slice(0, 7); // YYYY-MM
+    return start.slice(5); // MM-DD
+  }
+
+  function renderChart(buckets, interval) {
+    document.getElementById("chart-title").textContent =
+      "Views per " + interval;
+
     var chart = document.getElementById("chart");
     chart.innerHTML = "";
-    if (!days.length) return;
+    if (!buckets.length) return;
 
     var max = Math.max.apply(
       null,
-      days.map(function (d) {
+      buckets.map(function (d) {
         return d.views;
       }),
     );
     if (max === 0) max = 1;
 
-    days.forEach(function (d) {
+    buckets.forEach(function (d) {
       var pct = (d.views / max) * 100;
-      const format = Intl.DateTimeFormat("en");
-      var label = d.date.slice(5); // MM-DD
+      var label = bucketLabel(d.start, interval);
 
       var group = document.createElement("div");
       group.className = "bar-group";
@@ -119,7 +278,13 @@
 
       var tooltip = document.createElement("span");
       tooltip.className = "bar-tooltip";
-      tooltip.textContent = d.views + " views, " + d.visitors + " visitors";
+      tooltip.textContent =
+        d.start.replace("T", " ") +
+        ": " +
+        d.views +
+        " views, " +
+        d.visitors +
+        " visitors";
       bar.appendChild(tooltip);
 
       var lbl = document.createElement("span");
@@ -132,11 +297,275 @@
     });
   }
 
-  function renderTable(id, rows) {
+  function formatPage(d) {
+    d.avg_scroll_depth = d.avg_scroll_depth + "%";
+    d.avg_time_on_page = formatDuration(d.avg_time_on_page);
+    return d;
+  }
+
+  function formatLocation(d) {
+    d.label = countryLabel(d.label);
+    return d;
+  }
+
+  // Breakdown tables that open a details view listing all of their rows,
+  // with the URL for query string q and an optional row formatter.
+  const breakdowns = {
+    "pages-table": {
+      url: function (q) {
+        return "/api/stats/pages" + q;
+      },
+      format: formatPage,
+    },
+    "sources-table": {
+      url: function (q) {
+        return drill.source
+          ? "/api/stats/referrers" + q + drillQuery("source")
+          : "/api/stats/sources" + q;
+      },
+    },
+    "locations-table": {
+      url: function (q) {
+        return "/api/stats/locations" + q;
+      },
+      format: formatLocation,
+    },
+    "browsers-table": {
+      url: function (q) {
+        return "/api/stats/browsers" + q + drillQuery("browser");
+      },
+    },
+    "systems-table": {
+      url: function (q) {
+        return "/api/stats/systems" + q + drillQuery("os");
+      },
+    },
+    "devices-table": {
+      url: function (q) {
+        return "/api/stats/devices" + q;
+      },
+    },
+    "networks-table": {
+      url: function (q) {
+        return "/api/stats/networks" + q;
+      },
+    },
+    "hosts-table": {
+      url: function (q) {
+        return "/api/stats/hosts" + q;
+      },
+    },
+    "channels-table": {
+      url: function (q) {
+        return "/api/stats/channels" + q;
+      },
+    },
+    "utm-table": {
+      url: function (q) {
+        return "/api/stats/utm/" + utmReport + q;
+      },
+    },
+    "outbound-table": {
+      url: function (q) {
+        return "/api/stats/outbound" + q;
+      },
+    },
+    "downloads-table": {
+      url: function (q) {
+        return "/api/stats/downloads" + q;
+      },
+    },
+  };
+
+  const detailsPageSize = 50;
+  const detailsDialog = document.getElementById("details");
+  const detailsSearch = document.getElementById("details-search");
+  const detailsSort = document.getElementById("details-sort");
+  const detailsMore = document.getElementById("details-more");
+  // The open details view: its report, the rows loaded so far and the total.
+  let details = null;
+
+  document.querySelectorAll(".details-open").forEach(function (btn) {
+    btn.addEventListener("click", function () {
+      openDetails(btn.dataset.table);
+    });
+  });
+
+  document
+    .getElementById("details-close")
+    .addEventListener("click", function () {
+      detailsDialog.close();
+    });
+
+  let searchTimer = null;
+  detailsSearch.addEventListener("input", function () {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(reloadDetails, 300);
+  });
+  detailsSort.addEventListener("change", reloadDetails);
+  detailsMore.addEventListener("click", loadDetails);
+
+  function openDetails(tableId) {
+    const table = document.getElementById(tableId);
+    const title = table.closest(".table-section").querySelector("h2");
+    // The first text node leaves out the drill back button.
+    document.getElementById("details-title").textContent =
+      title.firstChild.textContent.trim();
+    document.querySelector("#details-table thead").innerHTML =
+      table.querySelector("thead").innerHTML;
+
+    details = { report: breakdowns[tableId], rows: [], total: 0 };
+    detailsSearch.value = "";
+    detailsSort.value = "views";
+    loadDetails();
+    detailsDialog.showModal();
+  }
+
+  function reloadDetails() {
+    details = { report: details.report, rows: [], total: 0 };
+    loadDetails();
+  }
+
+  function loadDetails() {
+    const current = details;
+    let q = query() + "&limit=" + detailsPageSize;
+    q += "&offset=" + current.rows.length + "&sort=" + detailsSort.value;
+    if (detailsSearch.value) {
+      q += "&q=" + encodeURIComponent(detailsSearch.value);
+    }
+
+    fetch(current.report.url(q))
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        // Ignore responses for a view that was closed or reloaded since.
+        if (details !== current) return;
+        const rows = current.report.format
+          ? data.rows.map(current.report.format)
+          : data.rows;
+        current.rows = current.rows.concat(rows);
+        current.total = data.total;
+        renderTable("details-table", current.rows);
+        document.getElementById("details-count").textContent =
+          current.rows.length + " of " + current.total;
+        detailsMore.hidden = current.rows.length >= current.total;
+      });
+  }
+
+  // Number of top rows in a breakdown table that get a sparkline.
+  const sparklineRows = 5;
+
+  // labels returns the first column of report rows, the value a row is
+  // grouped by.
+  function labels(rows) {
+    return rows.map(function (row) {
+      return Object.values(row)[0];
+    });
+  }
+
+  // sparklines draws the views over time of the top rows of a table next to
+  // their labels, using one time series request for all of them.
+  function sparklines(tableId, dimension, values, q) {
+    const rows = document.querySelectorAll("#" + tableId + " tbody tr");
+    values = values.slice(0, sparklineRows);
+    if (!values.length) return;
+
+    let url = "/api/stats/timeseries" + q + "&dimension=" + dimension;
+    values.forEach(function (value) {
+      url += "&value=" + encodeURIComponent(value);
+    });
+
+    fetch(url)
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        // Rows replaced by a newer refresh are detached, drawing into them
+        // is harmless.
+        data.values.forEach(function (v, i) {
+          rows[i].cells[0].appendChild(sparkline(v.series));
+        });
+      });
+  }
+
+  function sparkline(series) {
+    const ns = "http://www.w3.org/2000/svg";
+    const width = 60;
+    const height = 16;
+
+    const max =
+      Math.max.apply(
+        null,
+        series.map(function (d) {
+          return d.views;
+        }),
+      ) || 1;
+    const step = series.length > 1 ? width / (series.length - 1) : 0;
+    const points = series.map(function (d, i) {
+      const y = height - 1 - (d.views / max) * (height - 2);
+      return (i * step).toFixed(1) + "," + y.toFixed(1);
+    });
+
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("class", "sparkline");
+    svg.setAttribute("width", width);
+    svg.setAttribute("height", height);
+    svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+
+    const line = document.createElementNS(ns, "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.appendChild(line);
+    return svg;
+  }
+
+  function formatDuration(seconds) {
+    if (seconds < 60) return seconds + "s";
+    return Math.floor(seconds / 60) + "m " + (seconds % 60) + "s";
+  }
+
+  function drillQuery(key) {
+    return drill[key] ? "&" + key + "=" + encodeURIComponent(drill[key]) : "";
+  }
+
+  // drillInto returns a row click handler that drills into the clicked
+  // label, or null when already drilled in.
+  function drillInto(key) {
+    if (drill[key]) return null;
+    return function (row) {
+      drill[key] = row.label;
+      refresh();
+    };
+  }
+
+  function renderDrillTitle(id, title, key) {
+    var h = document.getElementById(id);
+    h.textContent = title;
+    if (!drill[key]) return;
+
+    h.textContent += " \u203a " + drill[key] + " ";
+    var back = document.createElement("button");
+    back.className = "drill-back";
+    back.textContent = "\u00d7";
+    back.title = "Back to all " + title.toLowerCase();
+    back.addEventListener("click", function () {
+      drill[key] = "";
+      refresh();
+    });
+    h.appendChild(back);
+  }
+
+  function renderTable(id, rows, onClick) {
     var tbody = document.querySelector("#" + id + " tbody");
     tbody.innerHTML = "";
     rows.forEach(function (row) {
       var tr = document.createElement("tr");
+      if (onClick) {
+        tr.className = "clickable";
+        tr.addEventListener("click", function () {
+          onClick(row);
+        });
+      }
       var values = Object.values(row);
       values.forEach(function (v) {
         var td = document.createElement("td");
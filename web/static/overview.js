@@ -0,0 +1,122 @@
+(function () {
+  "use strict";
+
+  const excludeDatacenter = document.getElementById("exclude-datacenter");
+  const combine = document.getElementById("combine");
+  let period = "7d";
+  // Domains checked for a combined dashboard.
+  const selected = new Set();
+
+  document.querySelectorAll(".periods button").forEach(function (btn) {
+    btn.addEventListener("click", function () {
+      document.querySelector(".periods .active").classList.remove("active");
+      btn.classList.add("active");
+      period = btn.dataset.period;
+      refresh();
+    });
+  });
+
+  excludeDatacenter.addEventListener("change", refresh);
+
+  function query() {
+    let q = "?period=" + period;
+    if (excludeDatacenter.checked) q += "&datacenter=exclude";
+    return q;
+  }
+
+  function dashboardURL(domains) {
+    return "/dashboard?domain=" + encodeURIComponent(domains.join(","));
+  }
+
+  function updateCombine() {
+    const domains = Array.from(selected);
+    combine.href = dashboardURL(domains);
+    combine.hidden = domains.length < 2;
+  }
+
+  function refresh() {
+    fetch("/api/stats/overview" + query())
+      .then(function (r) {
+        return r.json();
+      })
+      .then(function (data) {
+        renderSites(data.sites);
+      });
+  }
+
+  function renderSites(sites) {
+    const tbody = document.querySelector("#sites-table tbody");
+    tbody.innerHTML = "";
+    sites.forEach(function (site) {
+      const tr = document.createElement("tr");
+
+      const check = document.createElement("input");
+      check.type = "checkbox";
+      check.checked = selected.has(site.domain);
+      check.addEventListener("change", function () {
+        if (check.checked) selected.add(site.domain);
+        else selected.delete(site.domain);
+        updateCombine();
+      });
+      tr.appendChild(cell(check));
+
+      const link = document.createElement("a");
+      link.href = dashboardURL([site.domain]);
+      link.textContent = site.domain;
+      tr.appendChild(cell(link));
+
+      tr.appendChild(cell(sparkline(site.series)));
+      tr.appendChild(cell(site.views));
+      tr.appendChild(cell(site.visitors));
+      tr.appendChild(cell(change(site.views, site.previous_views)));
+      tbody.appendChild(tr);
+    });
+    updateCombine();
+  }
+
+  function cell(content) {
+    const td = document.createElement("td");
+    if (content instanceof Node) td.appendChild(content);
+    else td.textContent = content;
+    return td;
+  }
+
+  // change formats the views against the previous period.
+  function change(views, previous) {
+    if (previous === 0) return views === 0 ? "-" : "new";
+    const pct = Math.round(((views - previous) / previous) * 100);
+    return (pct > 0 ? "+" : "") + pct + "%";
+  }
+
+  function sparkline(series) {
+    const ns = "http://www.w3.org/2000/svg";
+    const width = 60;
+    const height = 16;
+
+    const max =
+      Math.max.apply(
+        null,
+        series.map(function (d) {
+          return d.views;
+        }),
+      ) || 1;
+    const step = series.length > 1 ? width / (series.length - 1) : 0;
+    const points = series.map(function (d, i) {
+      const y = height - 1 - (d.views / max) * (height - 2);
+      return (i * step).toFixed(1) + "," + y.toFixed(1);
+    });
+
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("class", "sparkline");
+    svg.setAttribute("width", width);
+    svg.setAttribute("height", height);
+    svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+
+    const line = document.createElementNS(ns, "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.appendChild(line);
+    return svg;
+  }
+
+  refresh();
+})();
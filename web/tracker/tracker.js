@@ -1,20 +1,341 @@
 (function () {
   "use strict";
-  const endpoint = new URL(document.currentScript.src).origin + "/api/event";
+  const script = document.currentScript;
+  const origin = new URL(script.src).origin;
+  const endpoint = origin + "/api/event";
+  const batchEndpoint = origin + "/api/events/batch";
+
+  const defaultDownloads =
+    "pdf,zip,dmg,exe,msi,pkg,deb,rpm,gz,tar,7z,rar,csv,xlsx,docx,pptx,epub,mp3,mp4,apk,iso";
+
+  // Configured through data-* attributes on the script tag:
+  //   data-auto="false"  don't track on load and navigation, call trackVisit()
+  //   data-hash="true"   treat #hash changes as page views (hash routers)
+  //   data-domain="..."  site to record under, defaults to location.hostname
+  //   data-outbound="true"  record clicks on links to other hosts
+  //   data-downloads="true" record clicks on file downloads, optionally with
+  //                         a comma-separated extension list ("pdf,zip")
+  const config = {
+    auto: script.dataset.auto !== "false",
+    hash: script.dataset.hash === "true",
+    domain: script.dataset.domain || location.hostname,
+    outbound: script.dataset.outbound === "true",
+    downloads: downloadExtensions(script.dataset.downloads),
+  };
+
+  function downloadExtensions(attr) {
+    if (!attr || attr === "false") return [];
+    if (attr === "true") attr = defaultDownloads;
+    return attr.split(",").map(function (ext) {
+      return ext.trim().replace(/^\./, "").toLowerCase();
+    });
+  }
+
+  // Only campaign parameters are sent, the rest of the query string is
+  // dropped so personal data in URLs never reaches the server.
+  const utmKeys = [
+    "utm_source",
+    "utm_medium",
+    "utm_campaign",
+    "utm_term",
+    "utm_content",
+  ];
+
+  let lastPath = null;
+
+  function currentPath() {
+    return config.hash ? location.pathname + location.hash : location.pathname;
+  }
 
   function send() {
-    const payload = JSON.stringify({
-      domain: location.hostname,
-      path: location.pathname,
-      referrer: document.referrer,
+    const path = currentPath();
+    // The referrer only applies to the page that was actually loaded, later
+    // SPA navigations are internal.
+    const referrer = lastPath === null ? document.referrer : "";
+    if (lastPath !== null) sendEngagement();
+    lastPath = path;
+    resetEngagement();
+
+    const params = new URLSearchParams(location.search);
+    const event = {
+      domain: config.domain,
+      // The site key may differ, the host (with port) is kept separately.
+      hostname: location.host,
+      path: path,
+      referrer: referrer,
       screen_size: window.screen.width + "x" + window.screen.height,
+    };
+    utmKeys.forEach(function (key) {
+      const value = params.get(key);
+      if (value) event[key] = value;
+    });
+
+    post(event);
+  }
+
+  // Engagement of the current page view: the deepest scroll position in
+  // percent and the time the page was visible.
+  let maxScroll = 0;
+  let engagedMs = 0;
+  let visibleSince = null;
+
+  function scrollDepth() {
+    const total = document.documentElement.scrollHeight;
+    if (!total) return 100;
+    const seen = window.scrollY + window.innerHeight;
+    return Math.min(100, Math.round((seen / total) * 100));
+  }
+
+  function resetEngagement() {
+    maxScroll = scrollDepth();
+    engagedMs = 0;
+    visibleSince = document.visibilityState === "visible" ? Date.now() : null;
+  }
+
+  function engagementTime() {
+    return engagedMs + (visibleSince ? Date.now() - visibleSince : 0);
+  }
+
+  // sendEngagement reports running totals for the current page view, the
+  // server keeps the largest values it has seen.
+  function sendEngagement() {
+    if (lastPath === null) return;
+    post({
+      type: "engagement",
+      domain: config.domain,
+      path: lastPath,
+      scroll_depth: maxScroll,
+      engagement_ms: engagementTime(),
     });
+  }
+
+  function handleScroll() {
+    maxScroll = Math.max(maxScroll, scrollDepth());
+  }
+
+  function handleVisibility() {
+    if (document.visibilityState === "hidden") {
+      engagedMs = engagementTime();
+      visibleSince = null;
+      sendEngagement();
+    } else if (visibleSince === null) {
+      visibleSince = Date.now();
+    }
+  }
+
+  // Visitors opt out through window.visitorOptOut() or by following the
+  // /opt-out page back to the site, which appends #visitor-opt-out.
+  const optOutKey = "visitor_opt_out";
+
+  function optedOut() {
+    try {
+      return localStorage.getItem(optOutKey) === "true";
+    } catch (e) {
+      return false;
+    }
+  }
+
+  function optOut() {
+    if (optedOut()) return;
+    // Let the site owner know how many visitors opted out, then go quiet.
+    post({ type: "opt_out", domain: config.domain, path: location.pathname });
+    try {
+      localStorage.setItem(optOutKey, "true");
+    } catch (e) {}
+    writeQueue([]);
+  }
+
+  // Events that couldn't be sent are kept in localStorage with the time they
+  // happened and flushed through the batch endpoint once the network is back.
+  // The server accepts them for up to a day.
+  const queueKey = "visitor_queue";
+  const maxQueue = 100;
+  const maxQueueAge = 24 * 60 * 60 * 1000;
+  let flushing = false;
+
+  function readQueue() {
+    try {
+      const queue = JSON.parse(localStorage.getItem(queueKey) || "[]");
+      return Array.isArray(queue) ? queue : [];
+    } catch (e) {
+      return [];
+    }
+  }
+
+  function writeQueue(queue) {
+    try {
+      if (queue.length) {
+        localStorage.setItem(queueKey, JSON.stringify(queue));
+      } else {
+        localStorage.removeItem(queueKey);
+      }
+    } catch (e) {}
+  }
+
+  function enqueue(event, at) {
+    event.timestamp = at;
+    // Keep the newest events when the queue is full.
+    writeQueue(readQueue().concat([event]).slice(-maxQueue));
+  }
+
+  function flush() {
+    if (flushing || optedOut() || !navigator.onLine || !window.fetch) return;
+
+    const cutoff = Date.now() - maxQueueAge;
+    const queue = readQueue().filter(function (event) {
+      return Date.parse(event.timestamp) > cutoff;
+    });
+    writeQueue(queue);
+    if (!queue.length) return;
+
+    flushing = true;
+    // Sent with CORS so the status is readable: a rate limited or failed
+    // batch stays queued for the next flush. The server skips invalid events,
+    // any other client error would come back on every retry.
+    fetch(batchEndpoint, {
+      method: "POST",
+      body: JSON.stringify({ events: queue }),
+      keepalive: true,
+      credentials: "include",
+    }).then(
+      function (response) {
+        // Events queued during the request stay for the next flush.
+        const status = response.status;
+        const refused = status >= 400 && status < 500 && status !== 429;
+        if (response.ok || refused) {
+          writeQueue(readQueue().slice(queue.length));
+        }
+        flushing = false;
+      },
+      function () {
+        flushing = false;
+      },
+    );
+  }
+
+  function optIn() {
+    try {
+      localStorage.removeItem(optOutKey);
+    } catch (e) {}
+  }
+
+  // transmit sends a payload without reading the response, which the CORS
+  // policy may hide. The promise only rejects on network errors.
+  function transmit(url, payload) {
+    return fetch(url, {
+      method: "POST",
+      body: payload,
+      mode: "no-cors",
+      keepalive: true,
+      credentials: "include",
+    });
+  }
+
+  function post(event) {
+    if (optedOut()) return;
+    const at = new Date().toISOString();
+    if (!navigator.onLine) {
+      enqueue(event, at);
+      return;
+    }
+
+    const payload = JSON.stringify(event);
     if (navigator.sendBeacon) {
-      navigator.sendBeacon(endpoint, payload);
-    } else {
-      fetch(endpoint, { method: "POST", body: payload, keepalive: true });
+      if (!navigator.sendBeacon(endpoint, payload)) enqueue(event, at);
+    } else if (window.fetch) {
+      transmit(endpoint, payload).catch(function () {
+        enqueue(event, at);
+      });
+    }
+  }
+
+  // linkType classifies a clicked link as a download, an outbound link or
+  // neither, according to the configuration.
+  function linkType(url) {
+    if (url.protocol !== "http:" && url.protocol !== "https:") return null;
+
+    const file = url.pathname.split("/").pop();
+    const ext = file.indexOf(".") !== -1 ? file.split(".").pop() : "";
+    if (ext && config.downloads.indexOf(ext.toLowerCase()) !== -1) {
+      return "download";
     }
+    if (config.outbound && url.host !== location.host) return "outbound";
+    return null;
+  }
+
+  function handleClick(e) {
+    const link = e.target.closest && e.target.closest("a[href]");
+    if (!link) return;
+
+    let url;
+    try {
+      url = new URL(link.href, location.href);
+    } catch (err) {
+      return;
+    }
+
+    const type = linkType(url);
+    if (!type) return;
+
+    post({
+      type: type,
+      domain: config.domain,
+      path: currentPath(),
+      url: url.href,
+    });
+  }
+
+  // navigate tracks a route change, skipping replaceState calls and
+  // re-renders that leave the path untouched.
+  function navigate() {
+    if (currentPath() !== lastPath) send();
+  }
+
+  function patch(method) {
+    const original = history[method];
+    history[method] = function () {
+      const result = original.apply(this, arguments);
+      navigate();
+      return result;
+    };
   }
 
   window.trackVisit = send;
+  window.visitorOptOut = optOut;
+  window.visitorOptIn = optIn;
+
+  // Drop the opt-out fragment again before any page view is tracked.
+  function clearHash() {
+    const url = location.pathname + location.search;
+    history.replaceState(history.state, "", url);
+  }
+
+  if (location.hash === "#visitor-opt-out") {
+    optOut();
+    clearHash();
+  } else if (location.hash === "#visitor-opt-in") {
+    optIn();
+    clearHash();
+  }
+
+  window.addEventListener("scroll", handleScroll, { passive: true });
+  document.addEventListener("visibilitychange", handleVisibility);
+  window.addEventListener("online", flush);
+  flush();
+
+  if (config.outbound || config.downloads.length) {
+    // Capture phase, so links that stop propagation are still seen. The
+    // beacon survives the navigation the click starts.
+    document.addEventListener("click", handleClick, true);
+    document.addEventListener("auxclick", handleClick, true);
+  }
+
+  if (!config.auto) return;
+
+  patch("pushState");
+  patch("replaceState");
+  window.addEventListener("popstate", navigate);
+  if (config.hash) window.addEventListener("hashchange", navigate);
+
+  send();
 })();